@@ -0,0 +1,451 @@
+package aggregate
+
+import "time"
+
+// Sizer returns the size of an item. If the item cannot be stored in an aggregate, then an error is returned.
+type Sizer[T any] func(T) (int, error)
+
+// Aggregator is the interface implemented by all aggregates that store items of type T.
+type Aggregator[T any] interface {
+	Add(T) error
+	Get() []T
+	Reset()
+	Count() int
+	Size() int
+	Expired() error
+	Deadline() time.Time
+}
+
+// Aggregate is an intermediary structure for storing items of any type. The size of each item is calculated by a pluggable Sizer.
+type Aggregate[T any] struct {
+	count, maxCount int
+	size, maxSize   int
+	maxDuration     time.Duration
+	maxIdle         time.Duration
+
+	sizer   Sizer[T]
+	clock   Clock
+	framing Framing
+	// split splits items that are larger than the maximum size into chunks and pending holds the chunks that have not been added to the payload.
+	split   func(T, int) []T
+	pending []T
+	// own copies an item into memory that is owned by the aggregate and release allows that memory to be reused once the items in it are no longer held in memory.
+	own     func(T) T
+	release func()
+	// detach abandons the memory that is owned by the aggregate so that it is not reused while the caller holds the payload.
+	detach func()
+	// fit replaces the size checks of the aggregate for payloads whose size is not the sum of the sizes of their items, such as compressed payloads; it returns the increase in the size of the payload if the item is added. encode writes an item to such a payload once it has passed all checks.
+	fit    func(T, int) (int, error)
+	encode func(T) error
+
+	deadLetter                      func(T, error)
+	deadLetterCount, deadLetterSize int
+
+	wal       *WAL
+	walEncode func(T) []byte
+	walDecode func([]byte) T
+
+	spill *spill[T]
+
+	metrics Metrics
+	// trigger is the reason that the payload will be flushed, which is set when an add attempt fails because the payload is full or expired.
+	trigger Trigger
+	// sequence is the number of the current payload (see Batch).
+	sequence uint64
+	// start and last are the times when the first and last items were added to the payload.
+	start, last time.Time
+	items       []T
+	// spare is a buffer that was released by the caller and is used by the next Swap.
+	spare []T
+	// inflight holds the payloads that were returned by Swap and whose records are kept in the write-ahead log until they are released, from oldest to newest.
+	inflight []inflight[T]
+}
+
+/*
+New initializes a new Aggregate with these settings:
+	maxCount:
+		the maximum number of items stored in the aggregate; when this value is reached, no more items can be added to the payload.
+	maxSize:
+		the maximum size of all items stored in the aggregate; when this value is reached, no more items can be added to the payload.
+	maxDuration:
+		the maximum duration that the aggregate will store items, measured from when the first item was added; when this duration is reached, no more items can be added to the payload.
+	sizer:
+		the function used to calculate the size of each item.
+*/
+func (a *Aggregate[T]) New(maxCount, maxSize int, maxDuration time.Duration, sizer Sizer[T]) {
+	a.count, a.size = 0, 0
+	a.maxCount = maxCount
+	a.maxSize = maxSize
+	a.maxDuration = maxDuration
+	a.sizer = sizer
+	if a.clock == nil {
+		a.clock = systemClock{}
+	}
+
+	a.start, a.last = time.Time{}, time.Time{}
+	a.items = make([]T, 0, initialCapacity(a.maxCount))
+	a.pending = nil
+	if a.release != nil {
+		a.release()
+	}
+	a.deadLetterCount, a.deadLetterSize = 0, 0
+	a.trigger = TriggerManual
+	a.sequence = 1
+}
+
+// Reset resets an Aggregate to its initialized settings and truncates the write-ahead log, if one is set (see SetWAL), which also removes the records of payloads that were returned by Swap and have not been released. If chunks of a split item are pending, then the next chunk is added to the payload.
+func (a *Aggregate[T]) Reset() {
+	a.reset(true)
+}
+
+// reset resets the aggregate. If truncate is false, then the records of the payload are kept in the write-ahead log.
+func (a *Aggregate[T]) reset(truncate bool) {
+	if a.metrics != nil {
+		a.observeFlush()
+	}
+
+	if a.count > 0 {
+		a.sequence++
+	}
+
+	a.count, a.size = 0, 0
+	a.trigger = TriggerManual
+
+	a.start, a.last = time.Time{}, time.Time{}
+	a.items = a.items[:0]
+
+	if a.release != nil {
+		a.release()
+	}
+
+	if a.spill != nil {
+		a.removeSegments()
+	}
+
+	if a.wal != nil && truncate {
+		// errors are kept by the WAL and returned by the next append.
+		_ = a.wal.Truncate()
+		for _, chunk := range a.pending {
+			_ = a.wal.Append(a.walEncode(chunk))
+		}
+		a.inflight = a.inflight[:0]
+	}
+
+	if len(a.pending) > 0 {
+		chunk := a.pending[0]
+		a.pending = a.pending[1:]
+
+		size, _ := a.sizer(chunk)
+		a.append(chunk, size)
+	}
+}
+
+/*
+Add adds an item to the aggregate payload, returning nil if the add succeeded and an error describing why the add failed otherwise:
+	ErrCountExceeded:
+		the payload holds the maximum number of items.
+	ErrSizeExceeded:
+		the item does not fit within the remaining size of the payload.
+	ErrExpired:
+		the payload has been stored longer than the maximum duration.
+	ErrIdle:
+		no item has been added to the payload for longer than the maximum idle duration.
+	ErrItemTooLarge:
+		the item, including any framing, is larger than the maximum size of the aggregate.
+
+If the size of the item cannot be calculated, the item cannot be appended to the write-ahead log, the payload cannot be written to a segment file, or the item cannot be encoded into the payload (see Compressed), then that error is returned. Items that fail with ErrItemTooLarge or a Sizer error are passed to the dead-letter handler, if one is set (see SetDeadLetter).
+
+If an add attempt fails with ErrCountExceeded, ErrSizeExceeded, ErrExpired, or ErrIdle, then the payload should be retrieved (see Get), the aggregate reset (see Reset), and the failed item should be reattempted.
+
+If an add attempt fails with any other error, then the item exceeds the configured limits of the aggregate and should not be reattempted.
+*/
+func (a *Aggregate[T]) Add(data T) error {
+	size, err := a.add(data)
+	if t, ok := triggerOf(err); ok {
+		a.trigger = t
+	}
+
+	if a.metrics != nil {
+		a.observeAdd(size, err)
+	}
+
+	return err
+}
+
+// add adds an item to the aggregate payload and returns the size of the item, as calculated by the Sizer. See Add.
+func (a *Aggregate[T]) add(data T) (int, error) {
+	newCount := a.count + 1
+	if newCount > a.maxCount {
+		return 0, ErrCountExceeded
+	}
+
+	// the payload is full until all chunks of a split item have been added.
+	if len(a.pending) > 0 {
+		return 0, ErrSizeExceeded
+	}
+
+	size, err := a.sizer(data)
+	if err != nil {
+		return 0, a.deadLetterItem(data, 0, err)
+	}
+
+	grow := size
+	if a.fit != nil {
+		grow, err = a.fit(data, size)
+		if err == ErrItemTooLarge {
+			return size, a.deadLetterItem(data, size, err)
+		}
+
+		if err != nil {
+			return size, err
+		}
+	} else {
+		if a.framing.Size(1, size) > a.maxSize {
+			if a.split == nil {
+				return size, a.deadLetterItem(data, size, ErrItemTooLarge)
+			}
+
+			return size, a.addSplit(data, size)
+		}
+
+		if a.framing.Size(newCount, a.size+size) > a.maxSize {
+			return size, ErrSizeExceeded
+		}
+	}
+
+	if err := a.Expired(); err != nil {
+		return size, err
+	}
+
+	if a.spill != nil && len(a.items) > 0 && a.spill.memory+grow > a.spill.maxMemory {
+		if err := a.spillItems(); err != nil {
+			return size, err
+		}
+	}
+
+	if a.wal != nil {
+		if err := a.wal.Append(a.walEncode(data)); err != nil {
+			return size, err
+		}
+	}
+
+	if a.encode != nil {
+		if err := a.encode(data); err != nil {
+			return size, err
+		}
+	}
+
+	a.append(data, grow)
+	return size, nil
+}
+
+// addSplit splits an item into chunks, adds the first chunk to the payload, and holds the remaining chunks until the payload is reset.
+func (a *Aggregate[T]) addSplit(data T, size int) error {
+	if a.count > 0 {
+		return ErrSizeExceeded
+	}
+
+	chunkSize := a.maxSize - a.framing.Size(1, 0)
+	if chunkSize <= ChunkHeaderSize {
+		return a.deadLetterItem(data, size, ErrItemTooLarge)
+	}
+
+	chunks := a.split(data, chunkSize)
+	if a.wal != nil {
+		for _, chunk := range chunks {
+			if err := a.wal.Append(a.walEncode(chunk)); err != nil {
+				return err
+			}
+		}
+	}
+	a.pending = chunks[1:]
+
+	size, _ = a.sizer(chunks[0])
+	a.append(chunks[0], size)
+
+	return nil
+}
+
+// deadLetterItem passes an item that can never be added to the dead-letter handler and returns the reason it was rejected.
+func (a *Aggregate[T]) deadLetterItem(data T, size int, reason error) error {
+	a.deadLetterCount++
+	a.deadLetterSize += size
+
+	if a.deadLetter != nil {
+		a.deadLetter(data, reason)
+	}
+
+	return reason
+}
+
+// append adds an item to the payload without checking the limits of the aggregate.
+func (a *Aggregate[T]) append(data T, size int) {
+	if a.own != nil {
+		data = a.own(data)
+	}
+
+	a.size += size
+	a.count++
+
+	a.last = a.clock.Now()
+	if a.count == 1 {
+		a.start = a.last
+	}
+	a.items = append(a.items, data)
+
+	if a.spill != nil {
+		a.spill.memory += size
+	}
+}
+
+// SetMaxIdle sets the maximum duration that the aggregate will wait between items, measured from when the last item was added; when this duration is reached, no more items can be added to the payload. A duration of zero disables the idle timeout.
+func (a *Aggregate[T]) SetMaxIdle(maxIdle time.Duration) {
+	a.maxIdle = maxIdle
+}
+
+// SetClock sets the clock that is used to enforce the maximum durations of the aggregate. By default, the system clock is used.
+func (a *Aggregate[T]) SetClock(clock Clock) {
+	a.clock = clock
+}
+
+// SetFraming sets the framing that is used to encode the aggregate payload. The overhead of the framing counts toward the maximum size of the aggregate, so the size of the payload (see Size) is the exact length of the encoded payload. The framing should be set before any items are added.
+func (a *Aggregate[T]) SetFraming(framing Framing) {
+	a.framing = framing
+}
+
+// SetDeadLetter sets the function that receives items that can never be added to the aggregate, along with the reason they were rejected. The function is called by Add before the error is returned.
+func (a *Aggregate[T]) SetDeadLetter(deadLetter func(data T, reason error)) {
+	a.deadLetter = deadLetter
+}
+
+// DeadLetterCount returns the number of items that could never be added to the aggregate since it was initialized.
+func (a *Aggregate[T]) DeadLetterCount() int {
+	return a.deadLetterCount
+}
+
+// DeadLetterSize returns the total size of the items that could never be added to the aggregate since it was initialized. Items whose size could not be calculated are not included.
+func (a *Aggregate[T]) DeadLetterSize() int {
+	return a.deadLetterSize
+}
+
+// SetWAL sets the write-ahead log that every item added to the aggregate is appended to, along with the functions used to encode items into records and decode records into items. The log is truncated when the aggregate is reset, so the aggregate should only be reset after the payload has been delivered; payloads that are removed with Swap keep their records until they are released (see Release).
+func (a *Aggregate[T]) SetWAL(wal *WAL, encode func(T) []byte, decode func([]byte) T) {
+	a.wal = wal
+	a.walEncode = encode
+	a.walDecode = decode
+}
+
+/*
+Recover adds the items stored in the write-ahead log to the aggregate. It should be called after the WAL is set and before any items are added.
+
+If the recovered items do not fit in one payload, then each full payload is passed to flush and the log is rewritten to contain only the items that have not been flushed. Items that can never be added to the aggregate are discarded.
+*/
+func (a *Aggregate[T]) Recover(flush func([]T)) error {
+	return a.recover(a, flush)
+}
+
+// recover adds the items stored in the write-ahead log to agg, which is the aggregate that embeds a.
+func (a *Aggregate[T]) recover(agg Aggregator[T], flush func([]T)) error {
+	if a.wal == nil {
+		return nil
+	}
+
+	records, err := a.wal.Records()
+	if err != nil {
+		return err
+	}
+
+	// the items are already in the log, so they are added without appending them again.
+	wal := a.wal
+	a.wal = nil
+	defer func() { a.wal = wal }()
+
+	for i, r := range records {
+		data := a.walDecode(r)
+
+		err := agg.Add(data)
+		switch err {
+		case ErrCountExceeded, ErrSizeExceeded, ErrExpired, ErrIdle:
+			flush(agg.Get())
+			agg.Reset()
+
+			if err := wal.Rewrite(records[i:]); err != nil {
+				return err
+			}
+
+			_ = agg.Add(data)
+		}
+	}
+
+	return nil
+}
+
+// Expired returns ErrExpired if the payload has been stored longer than the maximum duration, ErrIdle if no item has been added for longer than the maximum idle duration, or nil if neither has been reached. An empty payload never expires.
+func (a *Aggregate[T]) Expired() error {
+	if a.count == 0 {
+		return nil
+	}
+
+	now := a.clock.Now()
+	if now.Sub(a.start) > a.maxDuration {
+		a.trigger = TriggerAge
+		return ErrExpired
+	}
+
+	if a.maxIdle > 0 && now.Sub(a.last) > a.maxIdle {
+		a.trigger = TriggerAge
+		return ErrIdle
+	}
+
+	return nil
+}
+
+// Deadline returns the time when the payload will expire, whichever of the maximum duration or maximum idle duration is reached first. If the payload is empty or can never expire, then the zero time is returned.
+func (a *Aggregate[T]) Deadline() time.Time {
+	if a.count == 0 {
+		return time.Time{}
+	}
+
+	var deadline time.Time
+	if a.maxDuration != unlimitedDuration {
+		deadline = a.start.Add(a.maxDuration)
+	}
+
+	if a.maxIdle > 0 {
+		if idle := a.last.Add(a.maxIdle); deadline.IsZero() || idle.Before(deadline) {
+			deadline = idle
+		}
+	}
+
+	return deadline
+}
+
+/*
+Get returns the aggregate payload. If items have been written to segment files (see SetSpill), then they are read into memory; Iter should be used instead to stream large payloads.
+
+Get cannot return an error, so if a segment file cannot be read, then the items that were read are returned and the error is available from Err until the aggregate is reset.
+*/
+func (a *Aggregate[T]) Get() []T {
+	if a.spill == nil || len(a.spill.segments) == 0 {
+		return a.items
+	}
+
+	items := make([]T, 0, a.count)
+	it := a.Iter()
+	for it.Next() {
+		items = append(items, it.Item())
+	}
+	a.spill.err = it.Err()
+
+	return items
+}
+
+// Count returns the number of items in the aggregate payload.
+func (a *Aggregate[T]) Count() int {
+	return a.count
+}
+
+// Size returns the total size of the items in the aggregate payload, including any overhead from the framing of the aggregate (see SetFraming).
+func (a *Aggregate[T]) Size() int {
+	return a.framing.Size(a.count, a.size)
+}
@@ -0,0 +1,292 @@
+package aggregate
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jshlbrd/go-aggregate/aggregatetest"
+)
+
+type record struct {
+	id   int
+	body string
+}
+
+func recordSize(r record) (int, error) {
+	return len(r.body), nil
+}
+
+func TestAggregateCount(t *testing.T) {
+	var tests = []struct {
+		data     []record
+		expected int
+	}{
+		{
+			[]record{
+				{1, "foo"},
+				{2, "bar"},
+				{3, "baz"},
+			},
+			2,
+		},
+	}
+
+	for _, test := range tests {
+		agg := Aggregate[record]{}
+		agg.New(2, 100, time.Minute, recordSize)
+
+		for _, data := range test.data {
+			agg.Add(data)
+		}
+
+		if agg.Count() != test.expected {
+			t.Logf("expected %v, got %v", test.expected, agg.Count())
+			t.Fail()
+		}
+	}
+}
+
+func TestAggregateSize(t *testing.T) {
+	var tests = []struct {
+		data     []record
+		expected int
+	}{
+		{
+			[]record{
+				{1, "foo"},
+				{2, "bar"},
+				{3, "bazqux"},
+			},
+			6,
+		},
+	}
+
+	for _, test := range tests {
+		agg := Aggregate[record]{}
+		agg.New(100, 8, time.Minute, recordSize)
+
+		for _, data := range test.data {
+			agg.Add(data)
+		}
+
+		if agg.Size() != test.expected {
+			t.Logf("expected %v, got %v", test.expected, agg.Size())
+			t.Fail()
+		}
+	}
+}
+
+func TestAggregateGet(t *testing.T) {
+	var tests = []struct {
+		data     []record
+		expected []record
+	}{
+		{
+			[]record{
+				{1, "foo"},
+				{2, "bar"},
+			},
+			[]record{
+				{1, "foo"},
+				{2, "bar"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		agg := Aggregate[record]{}
+		agg.New(100, 100, time.Minute, recordSize)
+
+		for _, data := range test.data {
+			agg.Add(data)
+		}
+
+		payload := agg.Get()
+		for i, p := range payload {
+			if p != test.expected[i] {
+				t.Logf("expected %v, got %v", test.expected[i], p)
+				t.Fail()
+			}
+		}
+	}
+}
+
+func TestAggregateAdd(t *testing.T) {
+	var tests = []struct {
+		name     string
+		maxCount int
+		maxSize  int
+		data     []record
+		expected []error
+	}{
+		{
+			"success",
+			100,
+			100,
+			[]record{
+				{1, "foo"},
+				{2, "bar"},
+			},
+			[]error{nil, nil},
+		},
+		{
+			"count exceeded",
+			1,
+			100,
+			[]record{
+				{1, "foo"},
+				{2, "bar"},
+			},
+			[]error{nil, ErrCountExceeded},
+		},
+		{
+			"size exceeded",
+			100,
+			5,
+			[]record{
+				{1, "foo"},
+				{2, "bar"},
+			},
+			[]error{nil, ErrSizeExceeded},
+		},
+		{
+			"item too large",
+			100,
+			5,
+			[]record{
+				{1, "foobarbaz"},
+			},
+			[]error{ErrItemTooLarge},
+		},
+	}
+
+	for _, test := range tests {
+		agg := Aggregate[record]{}
+		agg.New(test.maxCount, test.maxSize, time.Minute, recordSize)
+
+		for i, data := range test.data {
+			if err := agg.Add(data); err != test.expected[i] {
+				t.Logf("%s: expected %v, got %v", test.name, test.expected[i], err)
+				t.Fail()
+			}
+		}
+	}
+}
+
+func TestAggregateExpired(t *testing.T) {
+	clock := aggregatetest.NewClock(time.Unix(0, 0))
+	agg := Aggregate[record]{}
+	agg.SetClock(clock)
+	agg.New(100, 100, time.Millisecond, recordSize)
+
+	agg.Add(record{1, "foo"})
+	clock.Advance(2 * time.Millisecond)
+
+	if err := agg.Add(record{2, "bar"}); err != ErrExpired {
+		t.Logf("expected %v, got %v", ErrExpired, err)
+		t.Fail()
+	}
+}
+
+// TestAggregateMaxAge tests that a steady trickle of items does not keep the payload open past the maximum duration.
+func TestAggregateMaxAge(t *testing.T) {
+	clock := aggregatetest.NewClock(time.Unix(0, 0))
+	agg := Aggregate[record]{}
+	agg.SetClock(clock)
+	agg.New(100, 100, 5*time.Millisecond, recordSize)
+
+	var err error
+	for i := 0; i < 10 && err == nil; i++ {
+		err = agg.Add(record{i, "foo"})
+		clock.Advance(time.Millisecond)
+	}
+
+	if err != ErrExpired || agg.Count() != 6 {
+		t.Logf("expected %v after %v items, got %v after %v items", ErrExpired, 6, err, agg.Count())
+		t.Fail()
+	}
+}
+
+func TestAggregateIdle(t *testing.T) {
+	clock := aggregatetest.NewClock(time.Unix(0, 0))
+	agg := Aggregate[record]{}
+	agg.SetClock(clock)
+	agg.New(100, 100, time.Minute, recordSize)
+	agg.SetMaxIdle(time.Millisecond)
+
+	agg.Add(record{1, "foo"})
+	clock.Advance(2 * time.Millisecond)
+
+	if err := agg.Expired(); err != ErrIdle {
+		t.Logf("expected %v, got %v", ErrIdle, err)
+		t.Fail()
+	}
+
+	if err := agg.Add(record{2, "bar"}); err != ErrIdle {
+		t.Logf("expected %v, got %v", ErrIdle, err)
+		t.Fail()
+	}
+
+	agg.Reset()
+	if err := agg.Expired(); err != nil {
+		t.Logf("expected %v, got %v", nil, err)
+		t.Fail()
+	}
+}
+
+func TestAggregateDeadLetter(t *testing.T) {
+	var tests = []struct {
+		data          []record
+		expected      []record
+		expectedCount int
+		expectedSize  int
+	}{
+		{
+			[]record{
+				{1, "foo"},
+				{2, "foobarbaz"},
+				{3, "bar"},
+				{4, "bazquxquux"},
+			},
+			[]record{
+				{2, "foobarbaz"},
+				{4, "bazquxquux"},
+			},
+			2,
+			19,
+		},
+	}
+
+	for _, test := range tests {
+		var deadLetters []record
+		agg := Aggregate[record]{}
+		agg.New(100, 8, time.Minute, recordSize)
+		agg.SetDeadLetter(func(r record, reason error) {
+			if reason != ErrItemTooLarge {
+				t.Logf("expected %v, got %v", ErrItemTooLarge, reason)
+				t.Fail()
+			}
+			deadLetters = append(deadLetters, r)
+		})
+
+		for _, data := range test.data {
+			agg.Add(data)
+		}
+
+		if len(deadLetters) != len(test.expected) {
+			t.Fatalf("expected %v, got %v", test.expected, deadLetters)
+		}
+
+		for i, r := range deadLetters {
+			if r != test.expected[i] {
+				t.Logf("expected %v, got %v", test.expected[i], r)
+				t.Fail()
+			}
+		}
+
+		if agg.DeadLetterCount() != test.expectedCount || agg.DeadLetterSize() != test.expectedSize {
+			t.Logf("expected %v and %v, got %v and %v", test.expectedCount, test.expectedSize, agg.DeadLetterCount(), agg.DeadLetterSize())
+			t.Fail()
+		}
+	}
+}
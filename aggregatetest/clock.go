@@ -0,0 +1,95 @@
+// Package aggregatetest provides utilities for testing code that uses aggregates.
+package aggregatetest
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is a fake clock that only moves when it is advanced. It implements the aggregate.Clock interface and is safe for concurrent use.
+type Clock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*timer
+}
+
+// timer is a function that is called when the clock reaches its deadline.
+type timer struct {
+	deadline time.Time
+	f        func()
+}
+
+// NewClock returns a Clock that starts at now.
+func NewClock(now time.Time) *Clock {
+	return &Clock{now: now}
+}
+
+// Now returns the current time of the clock.
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+// AfterFunc calls f in its own goroutine once the clock has been advanced by at least d. If d is not positive, then f is called immediately.
+func (c *Clock) AfterFunc(d time.Duration, f func()) func() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if d <= 0 {
+		go f()
+		return func() bool { return false }
+	}
+
+	t := &timer{deadline: c.now.Add(d), f: f}
+	c.timers = append(c.timers, t)
+	return func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		return c.remove(t)
+	}
+}
+
+// Advance moves the clock forward by d and calls the functions of all timers that have reached their deadline.
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+
+	var due []*timer
+	for _, t := range c.timers {
+		if !t.deadline.After(c.now) {
+			due = append(due, t)
+		}
+	}
+
+	for _, t := range due {
+		c.remove(t)
+	}
+	c.mu.Unlock()
+
+	for _, t := range due {
+		go t.f()
+	}
+}
+
+// Timers returns the number of timers that are waiting for the clock to reach their deadline.
+func (c *Clock) Timers() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.timers)
+}
+
+// remove removes a timer, returning false if it was not waiting.
+func (c *Clock) remove(t *timer) bool {
+	for i, w := range c.timers {
+		if w == t {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
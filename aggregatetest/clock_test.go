@@ -0,0 +1,64 @@
+package aggregatetest
+
+import (
+	"testing"
+	"time"
+)
+
+func TestClockAdvance(t *testing.T) {
+	var tests = []struct {
+		after    time.Duration
+		advance  []time.Duration
+		expected bool
+	}{
+		{time.Second, []time.Duration{500 * time.Millisecond}, false},
+		{time.Second, []time.Duration{500 * time.Millisecond, 500 * time.Millisecond}, true},
+		{time.Second, []time.Duration{2 * time.Second}, true},
+	}
+
+	for _, test := range tests {
+		start := time.Unix(0, 0)
+		c := NewClock(start)
+
+		fired := make(chan struct{}, 1)
+		c.AfterFunc(test.after, func() { fired <- struct{}{} })
+
+		var total time.Duration
+		for _, d := range test.advance {
+			c.Advance(d)
+			total += d
+		}
+
+		if !c.Now().Equal(start.Add(total)) {
+			t.Logf("expected %v, got %v", start.Add(total), c.Now())
+			t.Fail()
+		}
+
+		if test.expected {
+			select {
+			case <-fired:
+			case <-time.After(time.Second):
+				t.Log("expected timer to fire")
+				t.Fail()
+			}
+		} else if c.Timers() != 1 {
+			t.Logf("expected %v, got %v", 1, c.Timers())
+			t.Fail()
+		}
+	}
+}
+
+func TestClockStop(t *testing.T) {
+	c := NewClock(time.Unix(0, 0))
+	stop := c.AfterFunc(time.Second, func() {
+		t.Log("unexpected call")
+		t.Fail()
+	})
+
+	if !stop() || stop() {
+		t.Log("expected only the first stop to succeed")
+		t.Fail()
+	}
+
+	c.Advance(time.Minute)
+}
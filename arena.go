@@ -0,0 +1,57 @@
+package aggregate
+
+// arenaChunkSize is the size of each chunk of memory allocated by an arena. Items that are larger than a chunk are copied into their own allocation, which is not reused.
+const arenaChunkSize = 64 << 10
+
+// arena copies items into chunks of memory that are reused once all items in them are no longer needed.
+type arena struct {
+	chunks [][]byte
+	// i is the index of the chunk that items are copied into.
+	i int
+}
+
+// copy returns a copy of b that is stored in the arena. The copy is valid until the arena is reset.
+func (a *arena) copy(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+
+	if len(b) > arenaChunkSize {
+		c := make([]byte, len(b))
+		copy(c, b)
+
+		return c
+	}
+
+	for ; a.i < len(a.chunks); a.i++ {
+		c := a.chunks[a.i]
+		if cap(c)-len(c) >= len(b) {
+			n := len(c)
+			a.chunks[a.i] = append(c, b...)
+
+			// the capacity of the copy is limited so that appending to it cannot overwrite the next item.
+			return a.chunks[a.i][n : n+len(b) : n+len(b)]
+		}
+	}
+
+	c := make([]byte, len(b), arenaChunkSize)
+	copy(c, b)
+	a.chunks = append(a.chunks, c)
+
+	return c[:len(b):len(b)]
+}
+
+// reset allows all chunks to be reused. Copies returned before the reset are overwritten by later copies.
+func (a *arena) reset() {
+	for i := range a.chunks {
+		a.chunks[i] = a.chunks[i][:0]
+	}
+
+	a.i = 0
+}
+
+// detach removes all chunks from the arena so that copies returned before the call are never overwritten.
+func (a *arena) detach() {
+	a.chunks = nil
+	a.i = 0
+}
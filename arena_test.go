@@ -0,0 +1,64 @@
+package aggregate
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestArena(t *testing.T) {
+	var tests = []struct {
+		data [][]byte
+	}{
+		{
+			[][]byte{[]byte("foo"), []byte("bar"), {}, nil},
+		},
+		{
+			[][]byte{bytes.Repeat([]byte("a"), arenaChunkSize-1), []byte("bc"), bytes.Repeat([]byte("d"), arenaChunkSize+1)},
+		},
+	}
+
+	for _, test := range tests {
+		a := arena{}
+		for i := 0; i < 2; i++ {
+			var copies [][]byte
+			for _, data := range test.data {
+				copies = append(copies, a.copy(data))
+			}
+
+			for j, c := range copies {
+				if !bytes.Equal(c, test.data[j]) || (c == nil) != (test.data[j] == nil) {
+					t.Logf("expected %q, got %q", test.data[j], c)
+					t.Fail()
+				}
+
+				// appending to a copy cannot overwrite the next copy.
+				if cap(c) != len(c) {
+					t.Logf("expected capacity %v, got %v", len(c), cap(c))
+					t.Fail()
+				}
+			}
+
+			a.reset()
+		}
+	}
+}
+
+func TestArenaReuse(t *testing.T) {
+	a := arena{}
+	data := []byte("foo")
+
+	a.copy(data)
+	a.reset()
+
+	allocs := testing.AllocsPerRun(100, func() {
+		for i := 0; i < 1000; i++ {
+			a.copy(data)
+		}
+		a.reset()
+	})
+
+	if allocs != 0 {
+		t.Logf("expected no allocations, got %v", allocs)
+		t.Fail()
+	}
+}
@@ -0,0 +1,30 @@
+package aggregate
+
+import "time"
+
+// Batch is an aggregate payload together with metadata that describes it. Batches are numbered by Sequence so that downstream systems can order and deduplicate them.
+type Batch[T any] struct {
+	// Items are the items in the payload. They are only valid until the aggregate is reset.
+	Items []T
+	// Trigger is the reason that the payload ended; TriggerManual if it was retrieved before it was full or expired.
+	Trigger Trigger
+	// Opened is the time when the first item was added to the payload and Closed is the time when the batch was retrieved.
+	Opened, Closed time.Time
+	// Count is the number of items in the payload and Size is the size of the payload, including any framing.
+	Count, Size int
+	// Sequence is the number of the payload, starting from one when the aggregate is initialized and increasing each time a non-empty payload is reset.
+	Sequence uint64
+}
+
+// Batch returns the aggregate payload and its metadata. The trigger is the reason that the last add attempt failed or that Expired last reported, so Batch should be called before the failed item is reattempted. Like Get, Batch does not reset the aggregate; calling it again before Reset returns the same sequence number.
+func (a *Aggregate[T]) Batch() Batch[T] {
+	return Batch[T]{
+		Items:    a.Get(),
+		Trigger:  a.trigger,
+		Opened:   a.start,
+		Closed:   a.clock.Now(),
+		Count:    a.count,
+		Size:     a.Size(),
+		Sequence: a.sequence,
+	}
+}
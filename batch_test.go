@@ -0,0 +1,89 @@
+package aggregate
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jshlbrd/go-aggregate/aggregatetest"
+)
+
+func TestBatch(t *testing.T) {
+	type expected struct {
+		items    int
+		trigger  Trigger
+		sequence uint64
+		open     time.Duration
+	}
+
+	var tests = []struct {
+		data     []string
+		expected []expected
+	}{
+		{
+			[]string{"a", "b", "c", "dddddd", ""},
+			[]expected{
+				{2, TriggerCount, 1, time.Second},
+				{1, TriggerSize, 2, 0},
+				{1, TriggerAge, 3, 0},
+				{1, TriggerManual, 4, 0},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		clock := aggregatetest.NewClock(time.Unix(0, 0))
+
+		agg := Strings{}
+		agg.SetClock(clock)
+		agg.New(2, 6, time.Second)
+
+		var batches []Batch[string]
+		for i, data := range test.data {
+			// the last item arrives after the payload has expired.
+			if i == len(test.data)-1 {
+				clock.Advance(2 * time.Second)
+			}
+
+			if err := agg.Add(data); err != nil {
+				batches = append(batches, agg.Batch())
+				agg.Reset()
+				agg.Add(data)
+			}
+
+			clock.Advance(time.Second)
+		}
+		batches = append(batches, agg.Batch())
+
+		if len(batches) != len(test.expected) {
+			t.Fatalf("expected %v batches, got %v", len(test.expected), len(batches))
+		}
+
+		for i, b := range batches {
+			e := test.expected[i]
+			if b.Count != e.items || len(b.Items) != e.items || b.Trigger != e.trigger || b.Sequence != e.sequence {
+				t.Logf("expected %+v, got %+v", e, b)
+				t.Fail()
+			}
+
+			if b.Closed.Sub(b.Opened) < e.open {
+				t.Logf("expected the batch to be open for at least %v, got %v", e.open, b.Closed.Sub(b.Opened))
+				t.Fail()
+			}
+		}
+	}
+}
+
+func TestBatchEmpty(t *testing.T) {
+	agg := Bytes{}
+	agg.New(2, 100, time.Second)
+
+	// resetting an empty payload does not use a sequence number.
+	agg.Reset()
+	agg.Reset()
+
+	b := agg.Batch()
+	if b.Count != 0 || b.Sequence != 1 || !b.Opened.IsZero() {
+		t.Logf("expected an empty batch with sequence 1, got %+v", b)
+		t.Fail()
+	}
+}
@@ -4,83 +4,86 @@ import "time"
 
 // Bytes is an intermediary structure for storing bytes.
 type Bytes struct {
-	count, maxCount int
-	size, maxSize   int
-	maxDuration     time.Duration
+	Aggregate[[]byte]
 
-	now   time.Time
-	items [][]byte
+	arena      arena
+	contiguous *contiguous
 }
 
 /*
 New initializes a new Bytes aggregate with these settings:
 	maxCount:
-		the maximum number of strings stored in the aggregate; when this value is reached, no more strings can be added to the payload.
+		the maximum number of bytes stored in the aggregate; when this value is reached, no more bytes can be added to the payload.
 	maxSize:
-		the maximum size of all strings stored in the aggregate; when this value is reached, no more strings can be added to the payload.
+		the maximum size of all bytes stored in the aggregate; when this value is reached, no more bytes can be added to the payload.
 	maxDuration:
-		the maximum duration that the aggregate will store bytes; when this duration is reached, no more bytes can be added to the payload.
+		the maximum duration that the aggregate will store bytes, measured from when the first item was added; when this duration is reached, no more bytes can be added to the payload.
 */
 func (a *Bytes) New(maxCount, maxSize int, maxDuration time.Duration) {
-	a.count, a.size = 0, 0
-	a.maxCount = maxCount
-	a.maxSize = maxSize
-	a.maxDuration = maxDuration
-
-	a.now = time.Now()
-	a.items = make([][]byte, 0, a.maxCount)
+	a.Aggregate.New(maxCount, maxSize, maxDuration, bytesSize)
 }
 
-// Reset resets a Bytes aggregate to its initialized settings.
-func (a *Bytes) Reset() {
-	a.count, a.size = 0, 0
+/*
+SetSplit enables or disables splitting of items that are larger than the maximum size of the aggregate. When enabled, these items are split into chunks that each fit in an empty payload, and each chunk is prefixed with a header that identifies the item that it was split from (see ParseChunk and Reassembler).
 
-	a.now = time.Now()
-	a.items = a.items[:0]
+The first chunk is added to the payload and the remaining chunks are added one at a time each time the aggregate is reset. Until all chunks have been added, adding any other item fails with ErrSizeExceeded, so the payload should be retrieved until Count returns zero.
+*/
+func (a *Bytes) SetSplit(enabled bool) {
+	a.split = nil
+	if enabled {
+		a.split = splitItem[[]byte]
+	}
 }
 
 /*
-Add adds bytes to the aggregate payload, returning true if the add succeeded and false if the add failed.
-
-If an add attempt fails and the payload is not empty, then the payload should be retrieved (see Get), the aggregate reset (see Reset), and the failed bytes should be reattempted.
+SetCopy enables or disables copying each item into memory that is owned by the aggregate. By default, items are stored as is, so callers that reuse buffers (such as bufio.Scanner) overwrite items that are waiting to be flushed.
 
-If an add attempt fails and the payload is empty, then the bytes being added exceed the configured limits of the aggregate and should not be reattempted.
+When enabled, items are copied into an arena that is reused after the aggregate is reset, so copying does not allocate memory for each item. The items returned by Get are only valid until the aggregate is reset.
 */
-func (a *Bytes) Add(data []byte) bool {
-	newCount := a.count + 1
-	if newCount > a.maxCount {
-		return false
+func (a *Bytes) SetCopy(enabled bool) {
+	a.own, a.release, a.detach = nil, nil, nil
+	a.contiguous = nil
+	if enabled {
+		a.own, a.release, a.detach = a.arena.copy, a.arena.reset, a.arena.detach
 	}
+}
 
-	newSize := a.size + len(data)
-	if newSize > a.maxSize {
-		return false
-	}
+// SetWAL sets the write-ahead log that every item added to the aggregate is appended to. See Aggregate.SetWAL and Aggregate.Recover.
+func (a *Bytes) SetWAL(wal *WAL) {
+	a.Aggregate.SetWAL(wal, bytesEncode, bytesDecode)
+}
 
-	if time.Since(a.now) > a.maxDuration {
-		return false
-	}
+// SetSpill enables writing bytes to temporary segment files in dir when the size of the bytes held in memory would exceed maxMemory. See Aggregate.SetSpill and Aggregate.Iter.
+func (a *Bytes) SetSpill(dir string, maxMemory int) {
+	a.Aggregate.SetSpill(dir, maxMemory, bytesEncode, bytesDecode)
+}
 
-	a.size = newSize
-	a.count = newCount
+// MarshalBinary captures the state of the aggregate, including the payload, counters, limits, and the time when the first item was added. It implements encoding.BinaryMarshaler.
+func (a *Bytes) MarshalBinary() ([]byte, error) {
+	return a.marshalBinary(bytesEncode)
+}
 
-	a.now = time.Now()
-	a.items = append(a.items, data)
+// UnmarshalBinary initializes the aggregate and restores the state captured by MarshalBinary. Settings that refer to local resources, such as the write-ahead log, are not restored. It implements encoding.BinaryUnmarshaler.
+func (a *Bytes) UnmarshalBinary(b []byte) error {
+	return a.unmarshalBinary(b, bytesSize, bytesDecode)
+}
 
-	return true
+// Encode returns the aggregate payload encoded with the framing of the aggregate (see SetFraming), including items that were written to segment files (see SetSpill). If a segment file cannot be read, then the error is returned.
+func (a *Bytes) Encode() ([]byte, error) {
+	return encodeFramed(&a.Aggregate)
 }
 
-// Get returns the aggregate payload.
-func (a *Bytes) Get() [][]byte {
-	return a.items
+// bytesSize calculates the size of bytes.
+func bytesSize(b []byte) (int, error) {
+	return len(b), nil
 }
 
-// Count returns the number of strings in the aggregate payload.
-func (a *Bytes) Count() int {
-	return a.count
+// bytesEncode converts bytes into a record.
+func bytesEncode(b []byte) []byte {
+	return b
 }
 
-// Size returns the total size of the strings in the aggregate payload.
-func (a *Bytes) Size() int {
-	return a.size
+// bytesDecode converts a record into bytes.
+func bytesDecode(b []byte) []byte {
+	return b
 }
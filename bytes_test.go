@@ -2,12 +2,15 @@ package aggregate
 
 import (
 	"bytes"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/jshlbrd/go-aggregate/aggregatetest"
 )
 
 // TestBytesTimeout tests that the timeout is respected by configuring
-// a timeout of 1ms and sleeping for 1ms between each Add() call.
+// a timeout of 1ms and advancing the clock by 2ms between each Add() call.
 func TestBytesTimeout(t *testing.T) {
 	var tests = []struct {
 		data     [][]byte
@@ -30,11 +33,13 @@ func TestBytesTimeout(t *testing.T) {
 			t.Fail()
 		}
 
+		clock := aggregatetest.NewClock(time.Unix(0, 0))
 		agg := Bytes{}
+		agg.SetClock(clock)
 		agg.New(100, 100, dur)
 		for _, data := range test.data {
 			agg.Add(data)
-			time.Sleep(1 * time.Millisecond)
+			clock.Advance(2 * time.Millisecond)
 		}
 
 		if agg.Count() != test.expected {
@@ -202,6 +207,85 @@ func TestBytesReset(t *testing.T) {
 	}
 }
 
+func TestBytesCopy(t *testing.T) {
+	var tests = []struct {
+		copy     bool
+		expected []string
+	}{
+		{
+			false,
+			[]string{"baz", "baz", "baz"},
+		},
+		{
+			true,
+			[]string{"foo", "bar", "baz"},
+		},
+	}
+
+	for _, test := range tests {
+		agg := Bytes{}
+		agg.New(100, 100, time.Minute)
+		agg.SetCopy(test.copy)
+
+		// the buffer is reused for every item, like the buffer of a bufio.Scanner.
+		buf := make([]byte, 3)
+		for _, data := range []string{"foo", "bar", "baz"} {
+			copy(buf, data)
+			agg.Add(buf)
+		}
+
+		for i, p := range agg.Get() {
+			if string(p) != test.expected[i] {
+				t.Logf("expected %v, got %s", test.expected[i], p)
+				t.Fail()
+			}
+		}
+	}
+}
+
+func TestBytesCopySpill(t *testing.T) {
+	agg := Bytes{}
+	agg.New(100, 100, time.Minute)
+	agg.SetCopy(true)
+	agg.SetSpill(t.TempDir(), 6)
+
+	buf := make([]byte, 3)
+	for _, data := range []string{"foo", "bar", "baz", "qux"} {
+		copy(buf, data)
+		agg.Add(buf)
+	}
+
+	var items []string
+	for _, p := range agg.Get() {
+		items = append(items, string(p))
+	}
+
+	if strings.Join(items, ",") != "foo,bar,baz,qux" {
+		t.Logf("expected %v, got %v", "foo,bar,baz,qux", items)
+		t.Fail()
+	}
+}
+
+func TestBytesCopyAllocs(t *testing.T) {
+	agg := Bytes{}
+	agg.New(1000, 1<<20, time.Minute)
+	agg.SetCopy(true)
+
+	data := []byte("foo")
+	fill := func() {
+		for agg.Add(data) == nil {
+		}
+		agg.Reset()
+	}
+
+	// the first payload allocates the arena and the payload, which are reused by every later payload.
+	fill()
+	if allocs := testing.AllocsPerRun(10, fill); allocs != 0 {
+		t.Logf("expected no allocations, got %v", allocs)
+		t.Fail()
+	}
+}
+
 func benchmarkBytes(b *testing.B, data []byte) {
 	dur, _ := time.ParseDuration("1ms")
 
@@ -0,0 +1,26 @@
+package aggregate
+
+import "time"
+
+/*
+Clock is the source of time used by aggregates to enforce their maximum durations. By default, aggregates use the system clock.
+
+A fake Clock that is advanced manually is provided by the aggregatetest package, which makes tests of duration-based behavior deterministic.
+*/
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// AfterFunc calls f in its own goroutine after the duration elapses. The returned function stops the call if it has not happened yet, returning false if the call has already happened or been stopped.
+	AfterFunc(d time.Duration, f func()) (stop func() bool)
+}
+
+// systemClock is the Clock that uses the system time.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) AfterFunc(d time.Duration, f func()) func() bool {
+	return time.AfterFunc(d, f).Stop
+}
@@ -0,0 +1,229 @@
+package aggregate
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"time"
+)
+
+// Compressor is the interface implemented by streaming compression writers, such as *gzip.Writer.
+type Compressor interface {
+	io.WriteCloser
+	// Flush writes any pending data to the underlying writer.
+	Flush() error
+	// Reset discards the state of the compressor and makes it write to w.
+	Reset(w io.Writer)
+}
+
+/*
+Codec describes a streaming compression format used by the Compressed aggregate.
+
+Any compressor that implements the Compressor interface can be used. For example, the zstd encoder from github.com/klauspost/compress can be used by providing a NewWriter function that calls zstd.NewWriter and a Bound function that returns the worst case size of zstd frame blocks.
+*/
+type Codec struct {
+	// NewWriter returns a Compressor that writes to w.
+	NewWriter func(w io.Writer) (Compressor, error)
+	// Bound returns the maximum number of bytes written when n bytes of input are written and then flushed.
+	Bound func(n int) int
+	// Header is the maximum number of bytes written before the first compressed data.
+	Header int
+	// Trailer is the maximum number of bytes written when the compressor is closed after being flushed.
+	Trailer int
+}
+
+// Gzip is the Codec for gzip compression.
+var Gzip = Codec{
+	NewWriter: func(w io.Writer) (Compressor, error) {
+		return gzip.NewWriter(w), nil
+	},
+	Bound: func(n int) int {
+		if n == 0 {
+			return 0
+		}
+
+		// incompressible data is written as stored blocks, which have up to 5 bytes of overhead each, and a sync flush writes an empty stored block.
+		return n + 5*(n/16384+1) + 5
+	},
+	Header:  10,
+	Trailer: 13,
+}
+
+/*
+Compressed is an intermediary structure for storing strings or bytes as a compressed payload. Items are streamed into the compressor as they are added and the maximum size applies to the compressed payload. It is built on Aggregate, so it supports the same count, duration, and idle limits and implements Aggregator; Get returns the items in the payload and Encode returns the compressed payload.
+
+The compressed payload is discarded when the aggregate is reset, so it must be retrieved with Encode before Reset is called (for example, from the flush handler of an AutoFlusher, which is called before the aggregate is reset) or removed with Swap. Sync, Keyed, and Pipeline only pass the items of each payload to the caller, so they cannot be used to retrieve the compressed payload.
+
+The compressed size of pending data is estimated with the worst case bound of the codec. The compressor is only flushed to measure the exact compressed size when the estimate would exceed the maximum size, so the payload is never recompressed and never exceeds the maximum size.
+*/
+type Compressed[T string | []byte] struct {
+	Aggregate[T]
+
+	codec Codec
+	// framing is the framing that is used to join items before they are compressed. The framing of the embedded Aggregate is not set, so the size of the payload is the compressed size.
+	framing Framing
+	w       Compressor
+	buf     bytes.Buffer
+	// scratch holds the framed form of the item that is being added.
+	scratch []byte
+
+	// flushed is true if the compressor has been flushed since the last reset and pending is the number of bytes written since the last flush.
+	flushed bool
+	pending int
+	closed  bool
+}
+
+/*
+New initializes a new Compressed aggregate with these settings:
+	maxCount:
+		the maximum number of items stored in the aggregate; when this value is reached, no more items can be added to the payload.
+	maxSize:
+		the maximum size of the compressed payload; when this value is reached, no more items can be added to the payload.
+	maxDuration:
+		the maximum duration that the aggregate will store items, measured from when the first item was added; when this duration is reached, no more items can be added to the payload.
+	codec:
+		the compression format of the payload (for example, Gzip).
+*/
+func (a *Compressed[T]) New(maxCount, maxSize int, maxDuration time.Duration, codec Codec) error {
+	a.codec = codec
+
+	a.buf.Reset()
+	w, err := codec.NewWriter(&a.buf)
+	if err != nil {
+		return err
+	}
+	a.w = w
+
+	a.fit, a.encode, a.release = a.fitCompressed, a.writeCompressed, a.resetCompressed
+	a.Aggregate.New(maxCount, maxSize, maxDuration, compressedSize[T])
+
+	return nil
+}
+
+// SetFraming sets the framing that is used to join items before they are compressed. The framing should be set before any items are added.
+func (a *Compressed[T]) SetFraming(framing Framing) {
+	a.framing = framing
+}
+
+/*
+Encode closes the compressor and returns the compressed payload. If the payload is empty, then nil is returned.
+
+Once the payload has been encoded, adding items fails with ErrClosed until the aggregate is reset, and Size returns the exact size of the compressed payload. The payload is only valid until the aggregate is reset, so it should be retrieved before Reset or Swap is called.
+*/
+func (a *Compressed[T]) Encode() ([]byte, error) {
+	if a.count == 0 {
+		return nil, nil
+	}
+
+	if !a.closed {
+		if _, err := a.w.Write(a.framing.Suffix); err != nil {
+			return nil, err
+		}
+
+		if err := a.w.Close(); err != nil {
+			return nil, err
+		}
+
+		a.closed = true
+		a.size = a.buf.Len()
+	}
+
+	return a.buf.Bytes(), nil
+}
+
+/*
+Swap encodes the payload, removes it from the aggregate, and resets the aggregate, returning the compressed payload and the items in it. Unlike the payload returned by Encode, the compressed payload belongs to the caller and stays valid after the aggregate is reset. If the payload is empty, then nil is returned and the aggregate is not reset; if the payload cannot be encoded, then the error is returned and the aggregate is not reset.
+
+The items are returned as they are by Aggregate.Swap, so if a write-ahead log is set, then they must be released once the compressed payload is delivered (see Aggregate.Release).
+*/
+func (a *Compressed[T]) Swap() ([]byte, []T, error) {
+	payload, err := a.Encode()
+	if payload == nil || err != nil {
+		return nil, nil, err
+	}
+
+	// the buffer is handed to the caller, so the compressor writes to a new buffer after the reset.
+	a.buf = bytes.Buffer{}
+
+	return payload, a.Aggregate.Swap(), nil
+}
+
+// fitCompressed frames an item and returns the increase in the maximum size of the compressed payload if it is added. If the estimate would exceed the maximum size, then the compressor is flushed to measure the exact size before ErrSizeExceeded is returned.
+func (a *Compressed[T]) fitCompressed(data T, size int) (int, error) {
+	if a.closed {
+		return 0, ErrClosed
+	}
+
+	// the framed item and the suffix are the uncompressed bytes that this item adds to the payload.
+	item := a.scratch[:0]
+	if a.count == 0 {
+		item = append(item, a.framing.Prefix...)
+	} else {
+		item = append(item, a.framing.Delimiter...)
+	}
+	item = append(item, data...)
+	item = append(item, a.framing.Terminator...)
+	a.scratch = item
+
+	suffix := len(a.framing.Suffix)
+	if a.codec.Header+a.codec.Bound(len(a.framing.Prefix)+size+len(a.framing.Terminator)+suffix)+a.codec.Trailer > a.maxSize {
+		return 0, ErrItemTooLarge
+	}
+
+	if a.bound(len(item)+suffix) > a.maxSize {
+		if a.pending > 0 {
+			if err := a.flush(); err != nil {
+				return 0, err
+			}
+		}
+
+		if a.bound(len(item)+suffix) > a.maxSize {
+			return 0, ErrSizeExceeded
+		}
+	}
+
+	return a.bound(len(item)+suffix) - a.size, nil
+}
+
+// writeCompressed writes the item that was framed by fitCompressed to the compressor.
+func (a *Compressed[T]) writeCompressed(T) error {
+	if _, err := a.w.Write(a.scratch); err != nil {
+		return err
+	}
+
+	a.pending += len(a.scratch)
+	return nil
+}
+
+// resetCompressed discards the compressed payload and resets the compressor.
+func (a *Compressed[T]) resetCompressed() {
+	a.buf.Reset()
+	a.w.Reset(&a.buf)
+
+	a.flushed, a.pending, a.closed = false, 0, false
+}
+
+// bound returns the maximum size of the compressed payload if n more bytes are written to it.
+func (a *Compressed[T]) bound(n int) int {
+	size := a.buf.Len()
+	if !a.flushed {
+		size = a.codec.Header
+	}
+
+	return size + a.codec.Bound(a.pending+n) + a.codec.Trailer
+}
+
+// flush flushes the compressor so that the exact size of the compressed data is known.
+func (a *Compressed[T]) flush() error {
+	if err := a.w.Flush(); err != nil {
+		return err
+	}
+
+	a.flushed, a.pending = true, 0
+	return nil
+}
+
+// compressedSize calculates the uncompressed size of an item.
+func compressedSize[T string | []byte](data T) (int, error) {
+	return len(data), nil
+}
@@ -0,0 +1,284 @@
+package aggregate
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jshlbrd/go-aggregate/aggregatetest"
+)
+
+var _ Aggregator[string] = (*Compressed[string])(nil)
+
+func gunzip(t *testing.T, b []byte) []byte {
+	r, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	return out
+}
+
+// TestCompressedMaxSize tests that the compressed payload never exceeds the maximum size, for both compressible and incompressible data.
+func TestCompressedMaxSize(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+
+	var tests = []struct {
+		name    string
+		maxSize int
+		item    func() []byte
+	}{
+		{
+			"random",
+			4096,
+			func() []byte {
+				b := make([]byte, 1+rnd.Intn(300))
+				rnd.Read(b)
+				return b
+			},
+		},
+		{
+			"random large",
+			100000,
+			func() []byte {
+				b := make([]byte, 1+rnd.Intn(20000))
+				rnd.Read(b)
+				return b
+			},
+		},
+		{
+			"text",
+			1024,
+			func() []byte {
+				return []byte(strings.Repeat("foo bar baz ", 1+rnd.Intn(10)))
+			},
+		},
+	}
+
+	for _, test := range tests {
+		agg := Compressed[[]byte]{}
+		if err := agg.New(100000, test.maxSize, time.Minute, Gzip); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		agg.SetFraming(NDJSONFraming)
+
+		for batch := 0; batch < 20; batch++ {
+			var expected []byte
+			for {
+				item := test.item()
+				if err := agg.Add(item); err != nil {
+					if err != ErrSizeExceeded {
+						t.Fatalf("%s: unexpected error: %v", test.name, err)
+					}
+					break
+				}
+
+				expected = append(expected, item...)
+				expected = append(expected, '\n')
+			}
+
+			payload, err := agg.Encode()
+			if err != nil {
+				t.Fatalf("%s: unexpected error: %v", test.name, err)
+			}
+
+			if len(payload) > test.maxSize || len(payload) != agg.Size() {
+				t.Logf("%s: expected %v to be at most %v", test.name, len(payload), test.maxSize)
+				t.Fail()
+			}
+
+			if !bytes.Equal(gunzip(t, payload), expected) {
+				t.Logf("%s: decompressed payload does not match", test.name)
+				t.Fail()
+			}
+
+			agg.Reset()
+		}
+	}
+}
+
+// TestCompressedRatio tests that compressible data is limited by its compressed size rather than its uncompressed size.
+func TestCompressedRatio(t *testing.T) {
+	agg := Compressed[string]{}
+	agg.New(100000, 1024, time.Minute, Gzip)
+
+	item := "the quick brown fox jumps over the lazy dog"
+	size := 0
+	for {
+		if err := agg.Add(item); err != nil {
+			break
+		}
+		size += len(item)
+	}
+
+	if size < 10*1024 {
+		t.Logf("expected more than %v uncompressed bytes, got %v", 10*1024, size)
+		t.Fail()
+	}
+
+	if err := agg.Add(item); err != ErrSizeExceeded {
+		t.Logf("expected %v, got %v", ErrSizeExceeded, err)
+		t.Fail()
+	}
+
+	payload, _ := agg.Encode()
+	if len(payload) > 1024 {
+		t.Logf("expected %v to be at most %v", len(payload), 1024)
+		t.Fail()
+	}
+
+	if err := agg.Add("foo"); err != ErrClosed {
+		t.Logf("expected %v, got %v", ErrClosed, err)
+		t.Fail()
+	}
+}
+
+func TestCompressedAdd(t *testing.T) {
+	var tests = []struct {
+		name     string
+		maxCount int
+		maxSize  int
+		data     []string
+		expected []error
+	}{
+		{
+			"count exceeded",
+			2,
+			1024,
+			[]string{"foo", "bar", "baz"},
+			[]error{nil, nil, ErrCountExceeded},
+		},
+		{
+			"item too large",
+			100,
+			32,
+			[]string{strings.Repeat("a", 32)},
+			[]error{ErrItemTooLarge},
+		},
+	}
+
+	for _, test := range tests {
+		agg := Compressed[string]{}
+		agg.New(test.maxCount, test.maxSize, time.Minute, Gzip)
+
+		for i, data := range test.data {
+			if err := agg.Add(data); err != test.expected[i] {
+				t.Logf("%s: expected %v, got %v", test.name, test.expected[i], err)
+				t.Fail()
+			}
+		}
+	}
+}
+
+// TestCompressedExpired tests that Compressed enforces the duration limits of Aggregate.
+func TestCompressedExpired(t *testing.T) {
+	clock := aggregatetest.NewClock(time.Unix(0, 0))
+
+	agg := Compressed[string]{}
+	agg.SetClock(clock)
+	agg.New(100, 1024, time.Minute, Gzip)
+	agg.SetMaxIdle(time.Second)
+
+	if err := agg.Add("foo"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if deadline := agg.Deadline(); !deadline.Equal(time.Unix(1, 0)) {
+		t.Logf("expected %v, got %v", time.Unix(1, 0), deadline)
+		t.Fail()
+	}
+
+	clock.Advance(2 * time.Second)
+	if err := agg.Expired(); err != ErrIdle {
+		t.Logf("expected %v, got %v", ErrIdle, err)
+		t.Fail()
+	}
+
+	if err := agg.Add("bar"); err != ErrIdle {
+		t.Logf("expected %v, got %v", ErrIdle, err)
+		t.Fail()
+	}
+}
+
+// TestCompressedAutoFlusher tests that Compressed can be wrapped by an AutoFlusher and that the compressed payload can be retrieved by the flush handler.
+func TestCompressedAutoFlusher(t *testing.T) {
+	agg := &Compressed[string]{}
+	agg.New(2, 1024, time.Minute, Gzip)
+	agg.SetFraming(NDJSONFraming)
+
+	var payloads []string
+	f := AutoFlusher[string]{}
+	f.New(agg, func(batch []string) {
+		b, err := agg.Encode()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if agg.Size() != len(b) {
+			t.Logf("expected %v, got %v", len(b), agg.Size())
+			t.Fail()
+		}
+
+		payloads = append(payloads, string(gunzip(t, b)))
+	})
+
+	for _, item := range []string{"foo", "bar", "baz"} {
+		if err := f.Add(item); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	f.Close()
+
+	expected := []string{"foo\nbar\n", "baz\n"}
+	if len(payloads) != len(expected) {
+		t.Fatalf("expected %q, got %q", expected, payloads)
+	}
+
+	for i := range expected {
+		if payloads[i] != expected[i] {
+			t.Logf("expected %q, got %q", expected[i], payloads[i])
+			t.Fail()
+		}
+	}
+}
+
+func TestCompressedSwap(t *testing.T) {
+	agg := Compressed[string]{}
+	agg.New(2, 1024, time.Minute, Gzip)
+	agg.SetFraming(NDJSONFraming)
+
+	if b, items, err := agg.Swap(); b != nil || items != nil || err != nil {
+		t.Fatalf("expected an empty payload, got %q, %v, %v", b, items, err)
+	}
+
+	agg.Add("foo")
+	agg.Add("bar")
+
+	b, items, err := agg.Swap()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the swapped payload stays valid after items are added to the aggregate.
+	agg.Add("baz")
+	next, _ := agg.Encode()
+
+	if string(gunzip(t, b)) != "foo\nbar\n" || len(items) != 2 || items[0] != "foo" {
+		t.Logf("expected %q, got %q and %v", "foo\nbar\n", gunzip(t, b), items)
+		t.Fail()
+	}
+
+	if string(gunzip(t, next)) != "baz\n" {
+		t.Logf("expected %q, got %q", "baz\n", gunzip(t, next))
+		t.Fail()
+	}
+}
@@ -0,0 +1,99 @@
+package aggregate
+
+// contiguous holds the encoded payload of a Bytes aggregate in a single buffer.
+type contiguous struct {
+	buf []byte
+	// index holds the start and end offsets of each item in buf.
+	index []int
+}
+
+/*
+SetContiguous enables or disables storing the payload in a single contiguous buffer. When enabled, each item is copied into the buffer along with the framing of the aggregate (see SetFraming), so the encoded payload is available from Bytes without being copied again. The buffer is reused after the aggregate is reset, so adding items and retrieving payloads does not allocate memory once the buffer has grown to the size of a payload.
+
+The items returned by Get and Item and the payload returned by Bytes are only valid until the aggregate is reset. Contiguous mode copies every item, so SetCopy is not needed; it cannot be combined with SetSpill.
+*/
+func (a *Bytes) SetContiguous(enabled bool) {
+	a.own, a.release, a.detach = nil, nil, nil
+	a.contiguous = nil
+	if enabled {
+		a.contiguous = &contiguous{}
+		a.own, a.release, a.detach = a.appendContiguous, a.resetContiguous, a.detachContiguous
+	}
+}
+
+// Bytes returns the aggregate payload encoded with the framing of the aggregate. In contiguous mode (see SetContiguous), the payload is returned without being copied and is only valid until the next item is added or the aggregate is reset, and no error is returned; otherwise, it is the same as Encode.
+func (a *Bytes) Bytes() ([]byte, error) {
+	c := a.contiguous
+	if c == nil {
+		return a.Encode()
+	}
+
+	if len(c.index) == 0 {
+		a.growContiguous(append(c.buf[:0], a.framing.Prefix...))
+	}
+
+	// the suffix is written after the last item, where it is overwritten by the next item.
+	b := append(c.buf, a.framing.Suffix...)
+	a.growContiguous(b[:len(c.buf)])
+
+	return b, nil
+}
+
+// Item returns the item at index i of the aggregate payload. In contiguous mode (see SetContiguous), the item is read from the buffer that holds the payload.
+func (a *Bytes) Item(i int) []byte {
+	c := a.contiguous
+	if c == nil {
+		return a.items[i]
+	}
+
+	start, end := c.index[2*i], c.index[2*i+1]
+	return c.buf[start:end:end]
+}
+
+// appendContiguous appends an item and its framing to the buffer and returns the item in the buffer.
+func (a *Bytes) appendContiguous(data []byte) []byte {
+	c := a.contiguous
+
+	buf := c.buf
+	if len(c.index) == 0 {
+		buf = append(buf[:0], a.framing.Prefix...)
+	} else {
+		buf = append(buf, a.framing.Delimiter...)
+	}
+
+	start := len(buf)
+	buf = append(buf, data...)
+	end := len(buf)
+	buf = append(buf, a.framing.Terminator...)
+
+	a.growContiguous(buf)
+	c.index = append(c.index, start, end)
+
+	return buf[start:end:end]
+}
+
+// growContiguous replaces the buffer. If the buffer was reallocated, then the items in the payload are moved to the new buffer so that the old buffer can be garbage collected.
+func (a *Bytes) growContiguous(buf []byte) {
+	c := a.contiguous
+	if cap(buf) == cap(c.buf) {
+		c.buf = buf
+		return
+	}
+
+	c.buf = buf
+	for i := range a.items {
+		a.items[i] = a.Item(i)
+	}
+}
+
+// resetContiguous allows the buffer to be reused.
+func (a *Bytes) resetContiguous() {
+	a.contiguous.buf = a.contiguous.buf[:0]
+	a.contiguous.index = a.contiguous.index[:0]
+}
+
+// detachContiguous starts a new buffer so that the current buffer is not reused.
+func (a *Bytes) detachContiguous() {
+	a.contiguous.buf = nil
+	a.contiguous.index = a.contiguous.index[:0]
+}
@@ -0,0 +1,173 @@
+package aggregate
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestBytesContiguous(t *testing.T) {
+	var tests = []struct {
+		framing Framing
+		data    []string
+	}{
+		{
+			Framing{},
+			[]string{"foo", "bar", "baz"},
+		},
+		{
+			NDJSONFraming,
+			[]string{`{"a":1}`, `{"b":2}`},
+		},
+		{
+			JSONArrayFraming,
+			[]string{`1`, `2`, `3`},
+		},
+		{
+			JSONArrayFraming,
+			[]string{},
+		},
+	}
+
+	for _, test := range tests {
+		agg := Bytes{}
+		agg.New(100, 1000, time.Minute)
+		agg.SetFraming(test.framing)
+		agg.SetContiguous(true)
+
+		// the payload is added twice to check that the buffer is reused after a reset.
+		for i := 0; i < 2; i++ {
+			buf := make([]byte, 0, 16)
+			for _, data := range test.data {
+				buf = append(buf[:0], data...)
+				agg.Add(buf)
+			}
+
+			payload, _ := agg.Bytes()
+			encoded, _ := agg.Encode()
+			if !bytes.Equal(payload, encoded) || len(payload) != agg.Size() {
+				t.Logf("expected %q, got %q", encoded, payload)
+				t.Fail()
+			}
+
+			for j, data := range test.data {
+				if string(agg.Item(j)) != data || string(agg.Get()[j]) != data {
+					t.Logf("expected %v, got %s and %s", data, agg.Item(j), agg.Get()[j])
+					t.Fail()
+				}
+			}
+
+			agg.Reset()
+		}
+	}
+}
+
+func TestBytesContiguousGrow(t *testing.T) {
+	agg := Bytes{}
+	agg.New(10000, 1<<20, time.Minute)
+	agg.SetContiguous(true)
+
+	for i := 0; i < 1000; i++ {
+		agg.Add([]byte{byte(i)})
+	}
+
+	// items added before the buffer grew are moved to the new buffer.
+	b, _ := agg.Bytes()
+	for i, item := range agg.Get() {
+		if &item[0] != &b[i] {
+			t.Fatalf("expected item %v to be stored in the buffer", i)
+		}
+	}
+}
+
+func TestBytesContiguousSplit(t *testing.T) {
+	agg := Bytes{}
+	agg.New(10, 30, time.Minute)
+	agg.SetSplit(true)
+	agg.SetContiguous(true)
+
+	data := bytes.Repeat([]byte("a"), 30)
+	agg.Add(data)
+
+	r := Reassembler{}
+	var item []byte
+	for agg.Count() > 0 {
+		if payload, _ := agg.Bytes(); !bytes.Equal(payload, agg.Item(0)) {
+			t.Logf("expected %q, got %q", agg.Item(0), payload)
+			t.Fail()
+		}
+
+		item, _ = r.Add(agg.Item(0))
+		agg.Reset()
+	}
+
+	if !bytes.Equal(item, data) {
+		t.Logf("expected %s, got %s", data, item)
+		t.Fail()
+	}
+}
+
+func TestBytesContiguousAllocs(t *testing.T) {
+	agg := Bytes{}
+	agg.New(100, 1<<20, time.Minute)
+	agg.SetFraming(NDJSONFraming)
+	agg.SetContiguous(true)
+
+	data := []byte(`{"foo":"bar"}`)
+	fill := func() {
+		for agg.Add(data) == nil {
+		}
+		_, _ = agg.Bytes()
+		agg.Reset()
+	}
+
+	// the first payload grows the buffer, which is reused by every later payload.
+	fill()
+	if allocs := testing.AllocsPerRun(10, fill); allocs != 0 {
+		t.Logf("expected no allocations, got %v", allocs)
+		t.Fail()
+	}
+}
+
+func benchmarkBytesPayload(b *testing.B, contiguous bool) {
+	agg := Bytes{}
+	agg.New(1000, 1<<20, time.Minute)
+	agg.SetFraming(NDJSONFraming)
+	agg.SetContiguous(contiguous)
+
+	data := []byte(`{"foo":"bar","baz":123}`)
+	b.ReportAllocs()
+	b.SetBytes(int64(len(data)))
+
+	for i := 0; i < b.N; i++ {
+		if err := agg.Add(data); err != nil {
+			_, _ = agg.Bytes()
+			agg.Reset()
+			agg.Add(data)
+		}
+	}
+}
+
+func BenchmarkBytesPayload(b *testing.B) {
+	var tests = []struct {
+		name       string
+		contiguous bool
+	}{
+		{
+			"encode",
+			false,
+		},
+		{
+			"contiguous",
+			true,
+		},
+	}
+
+	for _, test := range tests {
+		b.Run(test.name,
+			func(b *testing.B) {
+				benchmarkBytesPayload(b, test.contiguous)
+			},
+		)
+	}
+}
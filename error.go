@@ -4,3 +4,21 @@ package aggregate
 type Error string
 
 func (e Error) Error() string { return string(e) }
+
+// ErrCountExceeded is returned when adding an item would exceed the maximum count of the aggregate.
+const ErrCountExceeded = Error("ErrCountExceeded")
+
+// ErrSizeExceeded is returned when adding an item would exceed the maximum size of the aggregate.
+const ErrSizeExceeded = Error("ErrSizeExceeded")
+
+// ErrExpired is returned when an item is added after the aggregate has exceeded its maximum duration, measured from the first item.
+const ErrExpired = Error("ErrExpired")
+
+// ErrIdle is returned when an item is added after the aggregate has exceeded its maximum idle duration, measured from the last item.
+const ErrIdle = Error("ErrIdle")
+
+// ErrItemTooLarge is returned when an item is larger than the maximum size of the aggregate and can never be added.
+const ErrItemTooLarge = Error("ErrItemTooLarge")
+
+// ErrClosed is returned when an item is added to an aggregate that has been closed.
+const ErrClosed = Error("ErrClosed")
@@ -0,0 +1,62 @@
+package aggregate
+
+import "expvar"
+
+// ExpvarMetrics is a Metrics that publishes the events of aggregates with the expvar package. It is safe for concurrent use, so it can be shared by multiple aggregates.
+type ExpvarMetrics struct {
+	recorder
+}
+
+/*
+New initializes a new ExpvarMetrics and publishes it as an expvar variable with these settings:
+	name:
+		the name of the variable; like all expvar variables, the name must be unique within the process and New panics if it is already in use.
+
+The variable is a JSON object that contains the number and size of added items, the number of rejected items by reason, the number of flushes by trigger, and histograms of the count, size, and open duration of each payload.
+*/
+func (m *ExpvarMetrics) New(name string) {
+	m.init()
+	expvar.Publish(name, expvar.Func(m.value))
+}
+
+// expvarHistogram is the representation of a histogram in an expvar variable. Buckets are cumulative and keyed by their upper bound.
+type expvarHistogram struct {
+	Buckets map[string]uint64 `json:"buckets"`
+	Count   uint64            `json:"count"`
+	Sum     float64           `json:"sum"`
+}
+
+// value returns the current value of the expvar variable.
+func (m *ExpvarMetrics) value() interface{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rejected := make(map[string]uint64, len(m.rejected))
+	for reason, n := range m.rejected {
+		rejected[reason] = n
+	}
+
+	flushes := make(map[string]uint64, len(triggers))
+	for _, t := range triggers {
+		flushes[t.String()] = m.flushes[t]
+	}
+
+	return map[string]interface{}{
+		"added":        m.added,
+		"added_size":   m.addedSize,
+		"rejected":     rejected,
+		"flushes":      flushes,
+		"batch_count":  newExpvarHistogram(&m.batchCount),
+		"batch_size":   newExpvarHistogram(&m.batchSize),
+		"batch_open_s": newExpvarHistogram(&m.batchOpen),
+	}
+}
+
+func newExpvarHistogram(h *histogram) expvarHistogram {
+	buckets := make(map[string]uint64, len(h.bounds))
+	for i, n := range h.cumulative() {
+		buckets[formatFloat(h.bounds[i])] = n
+	}
+
+	return expvarHistogram{Buckets: buckets, Count: h.count, Sum: h.sum}
+}
@@ -0,0 +1,63 @@
+package aggregate
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// expvarRuns is the number of times that TestExpvarMetrics has run, which keeps the name of the variable unique when tests are repeated.
+var expvarRuns int
+
+func TestExpvarMetrics(t *testing.T) {
+	expvarRuns++
+	name := fmt.Sprintf("aggregate_test_%d", expvarRuns)
+
+	m := ExpvarMetrics{}
+	m.New(name)
+
+	agg := Strings{}
+	agg.New(2, 100, time.Minute)
+	agg.SetMetrics(&m)
+
+	for _, data := range []string{"foo", "bar", "baz"} {
+		if err := agg.Add(data); err != nil {
+			agg.Reset()
+			agg.Add(data)
+		}
+	}
+
+	var v struct {
+		Added      uint64            `json:"added"`
+		AddedSize  uint64            `json:"added_size"`
+		Rejected   map[string]uint64 `json:"rejected"`
+		Flushes    map[string]uint64 `json:"flushes"`
+		BatchCount expvarHistogram   `json:"batch_count"`
+	}
+
+	if err := json.Unmarshal([]byte(expvar.Get(name).String()), &v); err != nil {
+		t.Fatal(err)
+	}
+
+	if v.Added != 3 || v.AddedSize != 9 {
+		t.Logf("expected 3 items with size 9, got %v items with size %v", v.Added, v.AddedSize)
+		t.Fail()
+	}
+
+	if v.Rejected["ErrCountExceeded"] != 1 {
+		t.Logf("expected %v, got %v", 1, v.Rejected["ErrCountExceeded"])
+		t.Fail()
+	}
+
+	if v.Flushes["count"] != 1 || v.Flushes["manual"] != 0 {
+		t.Logf("expected one count flush, got %v", v.Flushes)
+		t.Fail()
+	}
+
+	if v.BatchCount.Count != 1 || v.BatchCount.Buckets["10"] != 1 {
+		t.Logf("expected one payload with 2 items, got %+v", v.BatchCount)
+		t.Fail()
+	}
+}
@@ -0,0 +1,167 @@
+package aggregate
+
+import (
+	"sync"
+	"time"
+)
+
+// AutoFlusher wraps an aggregate and automatically passes its payload to a flush handler when the payload is full or has expired.
+type AutoFlusher[T any] struct {
+	mu     sync.Mutex
+	agg    Aggregator[T]
+	flush  func([]T)
+	clock  Clock
+	closed bool
+
+	wake chan struct{}
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+/*
+New initializes a new AutoFlusher with these settings:
+	agg:
+		the aggregate that items are added to; the aggregate should not be used directly while it is wrapped by the AutoFlusher.
+	flush:
+		the function that receives each payload; the payload is only valid until the function returns.
+
+New starts a goroutine that flushes the payload when it expires, even if no new items are added. The goroutine is stopped by Close.
+*/
+func (f *AutoFlusher[T]) New(agg Aggregator[T], flush func([]T)) {
+	f.agg = agg
+	f.flush = flush
+	f.closed = false
+	if f.clock == nil {
+		f.clock = systemClock{}
+	}
+
+	f.wake = make(chan struct{}, 1)
+	f.done = make(chan struct{})
+
+	f.wg.Add(1)
+	go f.run()
+}
+
+/*
+Add adds an item to the aggregate. If the aggregate is full or has expired, then the payload is flushed and the item is reattempted.
+
+If the item can never be added to the aggregate, then the error returned by the aggregate is returned. If the AutoFlusher is closed, then ErrClosed is returned.
+*/
+func (f *AutoFlusher[T]) Add(data T) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return ErrClosed
+	}
+
+	err := f.agg.Add(data)
+	switch err {
+	case ErrCountExceeded, ErrSizeExceeded, ErrExpired, ErrIdle:
+		f.flushLocked()
+		err = f.agg.Add(data)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	// the first item sets the deadline of the payload, so the timer goroutine is woken up to start waiting on it.
+	if f.agg.Count() == 1 {
+		select {
+		case f.wake <- struct{}{}:
+		default:
+		}
+	}
+
+	return nil
+}
+
+// SetClock sets the clock that is used to wait for the payload to expire. It should be the same clock that is used by the wrapped aggregate. By default, the system clock is used.
+func (f *AutoFlusher[T]) SetClock(clock Clock) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.clock = clock
+
+	// the timer goroutine is woken up so that it starts waiting on the new clock.
+	select {
+	case f.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Flush passes the payload to the flush handler and resets the aggregate. If the payload is empty, then the flush handler is not called.
+func (f *AutoFlusher[T]) Flush() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.flushLocked()
+}
+
+// Close flushes any remaining payload and stops the timer goroutine. If the AutoFlusher is already closed, then ErrClosed is returned.
+func (f *AutoFlusher[T]) Close() error {
+	f.mu.Lock()
+	if f.closed {
+		f.mu.Unlock()
+		return ErrClosed
+	}
+
+	f.closed = true
+	f.flushLocked()
+	f.mu.Unlock()
+
+	close(f.done)
+	f.wg.Wait()
+
+	return nil
+}
+
+// flushLocked passes the payload to the flush handler and resets the aggregate until the payload is empty. The caller must hold the lock.
+func (f *AutoFlusher[T]) flushLocked() {
+	for f.agg.Count() > 0 {
+		f.flush(f.agg.Get())
+		f.agg.Reset()
+	}
+}
+
+// run flushes the payload whenever it expires.
+func (f *AutoFlusher[T]) run() {
+	defer f.wg.Done()
+
+	for {
+		f.mu.Lock()
+		deadline := f.agg.Deadline()
+		clock := f.clock
+		f.mu.Unlock()
+
+		var stop func() bool
+		var expire chan struct{}
+		if !deadline.IsZero() {
+			// the payload expires once its deadline has passed, so the timer fires just after the deadline.
+			expire = make(chan struct{}, 1)
+			stop = clock.AfterFunc(deadline.Sub(clock.Now())+time.Nanosecond, func() {
+				expire <- struct{}{}
+			})
+		}
+
+		select {
+		case <-f.done:
+			if stop != nil {
+				stop()
+			}
+			return
+		case <-f.wake:
+		case <-expire:
+			f.mu.Lock()
+			if f.agg.Expired() != nil {
+				f.flushLocked()
+			}
+			f.mu.Unlock()
+		}
+
+		if stop != nil {
+			stop()
+		}
+	}
+}
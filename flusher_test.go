@@ -0,0 +1,142 @@
+package aggregate
+
+import (
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jshlbrd/go-aggregate/aggregatetest"
+)
+
+func TestAutoFlusherAdd(t *testing.T) {
+	var tests = []struct {
+		data     []string
+		expected [][]string
+	}{
+		{
+			[]string{
+				"foo",
+				"bar",
+				"baz",
+			},
+			[][]string{
+				{"foo", "bar"},
+				{"baz"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		agg := Strings{}
+		agg.New(2, 100, time.Minute)
+
+		var batches [][]string
+		f := AutoFlusher[string]{}
+		f.New(&agg, func(batch []string) {
+			batches = append(batches, append([]string(nil), batch...))
+		})
+
+		for _, data := range test.data {
+			if err := f.Add(data); err != nil {
+				t.Logf("unexpected error: %v", err)
+				t.Fail()
+			}
+		}
+
+		if err := f.Close(); err != nil {
+			t.Logf("unexpected error: %v", err)
+			t.Fail()
+		}
+
+		if len(batches) != len(test.expected) {
+			t.Fatalf("expected %v, got %v", test.expected, batches)
+		}
+
+		for i, batch := range batches {
+			for j, item := range batch {
+				if item != test.expected[i][j] {
+					t.Logf("expected %v, got %v", test.expected[i][j], item)
+					t.Fail()
+				}
+			}
+		}
+	}
+}
+
+// TestAutoFlusherTimeout tests that an expired payload is flushed without any new items being added.
+func TestAutoFlusherTimeout(t *testing.T) {
+	clock := aggregatetest.NewClock(time.Unix(0, 0))
+	agg := Strings{}
+	agg.SetClock(clock)
+	agg.New(100, 100, 5*time.Millisecond)
+
+	flushed := make(chan []string, 1)
+	f := AutoFlusher[string]{}
+	f.SetClock(clock)
+	f.New(&agg, func(batch []string) {
+		flushed <- append([]string(nil), batch...)
+	})
+	defer f.Close()
+
+	f.Add("foo")
+
+	// the timer goroutine waits on the clock once it has seen the first item.
+	for clock.Timers() == 0 {
+		runtime.Gosched()
+	}
+
+	clock.Advance(5 * time.Millisecond)
+	select {
+	case batch := <-flushed:
+		t.Logf("unexpected flush: %v", batch)
+		t.Fail()
+	default:
+	}
+
+	clock.Advance(time.Millisecond)
+
+	select {
+	case batch := <-flushed:
+		if len(batch) != 1 || batch[0] != "foo" {
+			t.Logf("expected %v, got %v", []string{"foo"}, batch)
+			t.Fail()
+		}
+	case <-time.After(time.Second):
+		t.Log("expected payload to be flushed")
+		t.Fail()
+	}
+}
+
+func TestAutoFlusherClose(t *testing.T) {
+	agg := Bytes{}
+	agg.New(100, 100, time.Minute)
+
+	var mu sync.Mutex
+	count := 0
+	f := AutoFlusher[[]byte]{}
+	f.New(&agg, func(batch [][]byte) {
+		mu.Lock()
+		count += len(batch)
+		mu.Unlock()
+	})
+
+	f.Add([]byte("foo"))
+	f.Add([]byte("bar"))
+	f.Close()
+
+	if count != 2 {
+		t.Logf("expected %v, got %v", 2, count)
+		t.Fail()
+	}
+
+	if err := f.Add([]byte("baz")); err != ErrClosed {
+		t.Logf("expected %v, got %v", ErrClosed, err)
+		t.Fail()
+	}
+
+	if err := f.Close(); err != ErrClosed {
+		t.Logf("expected %v, got %v", ErrClosed, err)
+		t.Fail()
+	}
+}
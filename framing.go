@@ -0,0 +1,45 @@
+package aggregate
+
+// Framing describes how the items in a payload are joined into a single encoded payload. The zero value joins items without any framing.
+type Framing struct {
+	// Prefix is written once before the first item.
+	Prefix []byte
+	// Delimiter is written between each item.
+	Delimiter []byte
+	// Terminator is written after each item.
+	Terminator []byte
+	// Suffix is written once after the last item.
+	Suffix []byte
+}
+
+var (
+	// NDJSONFraming encodes items as newline delimited JSON, with each item terminated by a newline.
+	NDJSONFraming = Framing{Terminator: []byte("\n")}
+	// JSONArrayFraming encodes items as a JSON array.
+	JSONArrayFraming = Framing{Prefix: []byte("["), Delimiter: []byte(","), Suffix: []byte("]")}
+)
+
+// Size returns the length of an encoded payload that contains count items with a combined length of size.
+func (f Framing) Size(count, size int) int {
+	size += len(f.Prefix) + len(f.Suffix) + count*len(f.Terminator)
+	if count > 1 {
+		size += (count - 1) * len(f.Delimiter)
+	}
+
+	return size
+}
+
+// appendFramed appends the encoded payload of items to dst.
+func appendFramed[T string | []byte](f Framing, dst []byte, items []T) []byte {
+	dst = append(dst, f.Prefix...)
+	for i, item := range items {
+		if i > 0 {
+			dst = append(dst, f.Delimiter...)
+		}
+
+		dst = append(dst, item...)
+		dst = append(dst, f.Terminator...)
+	}
+
+	return append(dst, f.Suffix...)
+}
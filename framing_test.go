@@ -0,0 +1,155 @@
+package aggregate
+
+import (
+	"testing"
+	"time"
+)
+
+// encoder is implemented by every aggregate that encodes its payload with its framing.
+type encoder interface {
+	Encode() ([]byte, error)
+}
+
+var (
+	_ encoder = (*Strings)(nil)
+	_ encoder = (*Bytes)(nil)
+	_ encoder = (*JSON)(nil)
+)
+
+func TestFramingSize(t *testing.T) {
+	var tests = []struct {
+		name     string
+		framing  Framing
+		data     []string
+		expected string
+	}{
+		{
+			"none",
+			Framing{},
+			[]string{"foo", "bar", "baz"},
+			"foobarbaz",
+		},
+		{
+			"ndjson",
+			NDJSONFraming,
+			[]string{"foo", "bar", "baz"},
+			"foo\nbar\nbaz\n",
+		},
+		{
+			"array",
+			JSONArrayFraming,
+			[]string{`"foo"`, `"bar"`},
+			`["foo","bar"]`,
+		},
+		{
+			"array empty",
+			JSONArrayFraming,
+			[]string{},
+			`[]`,
+		},
+		{
+			"delimited",
+			Framing{Delimiter: []byte("\r\n")},
+			[]string{"foo", "bar", "baz"},
+			"foo\r\nbar\r\nbaz",
+		},
+	}
+
+	for _, test := range tests {
+		agg := Strings{}
+		agg.New(100, 100, time.Minute)
+		agg.SetFraming(test.framing)
+
+		for _, data := range test.data {
+			if err := agg.Add(data); err != nil {
+				t.Logf("%s: unexpected error: %v", test.name, err)
+				t.Fail()
+			}
+		}
+
+		if payload, _ := agg.Encode(); string(payload) != test.expected {
+			t.Logf("%s: expected %q, got %q", test.name, test.expected, string(payload))
+			t.Fail()
+		}
+
+		if agg.Size() != len(test.expected) {
+			t.Logf("%s: expected %v, got %v", test.name, len(test.expected), agg.Size())
+			t.Fail()
+		}
+	}
+}
+
+// TestFramingMaxSize tests that the overhead of the framing counts toward the maximum size of the aggregate.
+func TestFramingMaxSize(t *testing.T) {
+	var tests = []struct {
+		name     string
+		framing  Framing
+		maxSize  int
+		data     [][]byte
+		expected []error
+	}{
+		{
+			"ndjson",
+			NDJSONFraming,
+			8,
+			[][]byte{
+				[]byte("foo"),
+				[]byte("bar"),
+				[]byte("baz"),
+			},
+			[]error{nil, nil, ErrSizeExceeded},
+		},
+		{
+			"array",
+			JSONArrayFraming,
+			8,
+			[][]byte{
+				[]byte("123"),
+				[]byte("456"),
+			},
+			[]error{nil, ErrSizeExceeded},
+		},
+		{
+			"item too large",
+			JSONArrayFraming,
+			4,
+			[][]byte{
+				[]byte("123"),
+			},
+			[]error{ErrItemTooLarge},
+		},
+	}
+
+	for _, test := range tests {
+		agg := Bytes{}
+		agg.New(100, test.maxSize, time.Minute)
+		agg.SetFraming(test.framing)
+
+		for i, data := range test.data {
+			if err := agg.Add(data); err != test.expected[i] {
+				t.Logf("%s: expected %v, got %v", test.name, test.expected[i], err)
+				t.Fail()
+			}
+		}
+
+		if payload, _ := agg.Encode(); agg.Size() > test.maxSize || agg.Size() != len(payload) {
+			t.Logf("%s: expected size %v to be at most %v and equal to %v", test.name, agg.Size(), test.maxSize, len(payload))
+			t.Fail()
+		}
+	}
+}
+
+func TestJSONFraming(t *testing.T) {
+	agg := JSON{}
+	agg.New(100, 100, time.Minute)
+	agg.SetFraming(JSONArrayFraming)
+
+	agg.Add(map[string]string{"foo": "bar"})
+	agg.Add(1)
+
+	expected := `[{"foo":"bar"},1]`
+	if payload, _ := agg.Encode(); string(payload) != expected || agg.Size() != len(expected) {
+		t.Logf("expected %v, got %v (%v)", expected, string(payload), agg.Size())
+		t.Fail()
+	}
+}
@@ -0,0 +1,312 @@
+package aggregate
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ErrHTTPStatus is returned when a batch is rejected by an HTTP server.
+const ErrHTTPStatus = Error("ErrHTTPStatus")
+
+// maxDrain is the largest number of bytes read from a response body so that the connection can be reused.
+const maxDrain = 64 << 10
+
+// HTTPSink sends each batch that it receives to a URL in the body of a POST request. HTTPSinks are not safe for concurrent use; when used as the flush handler of an AutoFlusher, batches are already received one at a time.
+type HTTPSink[T any] struct {
+	url         string
+	contentType string
+	enc         batchEncoder[T]
+
+	client *http.Client
+	header http.Header
+	gzip   bool
+
+	maxRetries             int
+	minBackoff, maxBackoff time.Duration
+	clock                  Clock
+	onFailure              func([]T, error)
+
+	// wait waits for the duration before a retry; it is replaced in tests.
+	wait func(context.Context, time.Duration) error
+
+	buf, gzbuf []byte
+	gz         *gzip.Writer
+}
+
+/*
+New initializes a new HTTPSink with these settings:
+	url:
+		the URL that each batch is sent to.
+	contentType:
+		the value of the Content-Type header of each request; for example, "application/x-ndjson" or "application/json".
+	framing:
+		the framing that is used to join the items of each batch; for example, NDJSONFraming or JSONArrayFraming.
+	marshal:
+		the function that appends the encoded form of an item to a buffer.
+
+By default, requests are sent with http.DefaultClient and failed requests are retried 3 times with a backoff between 100ms and 10s (see SetRetry). StringsHTTPSink, BytesHTTPSink, and JSONHTTPSink create HTTPSinks for the items of Strings, Bytes, and JSON aggregates.
+*/
+func (s *HTTPSink[T]) New(url, contentType string, framing Framing, marshal func(dst []byte, item T) ([]byte, error)) {
+	s.url = url
+	s.contentType = contentType
+	s.enc = batchEncoder[T]{framing: framing, marshal: marshal}
+
+	s.client = http.DefaultClient
+	s.header = make(http.Header)
+	s.maxRetries, s.minBackoff, s.maxBackoff = 3, 100*time.Millisecond, 10*time.Second
+	if s.clock == nil {
+		s.clock = systemClock{}
+	}
+	s.wait = s.sleep
+}
+
+// SetClient sets the client that is used to send requests. By default, http.DefaultClient is used.
+func (s *HTTPSink[T]) SetClient(client *http.Client) {
+	s.client = client
+}
+
+// SetHeader sets a header that is sent with every request, replacing any values of the header that were set before.
+func (s *HTTPSink[T]) SetHeader(key, value string) {
+	s.header.Set(key, value)
+}
+
+// SetGzip enables or disables compressing the body of each request with gzip. When enabled, requests are sent with the Content-Encoding header set to gzip.
+func (s *HTTPSink[T]) SetGzip(enabled bool) {
+	s.gzip = enabled
+}
+
+/*
+SetRetry sets how requests that fail are retried. A request is retried if it cannot be sent or if the server responds with 429 Too Many Requests or a 5xx status; other responses are permanent failures. Retries are attempted with these settings:
+	maxRetries:
+		the maximum number of times that a batch is retried after the first request fails; a value of zero disables retries.
+	minBackoff:
+		the backoff before the first retry, which is doubled for each later retry.
+	maxBackoff:
+		the maximum backoff before any retry.
+
+Each backoff is randomized to between half of and the full backoff (jitter), so that many senders do not retry at the same time. If the server responds with a Retry-After header, then a request is never retried before its delay; if the delay is longer than maxBackoff, then the batch is not retried and fails instead.
+*/
+func (s *HTTPSink[T]) SetRetry(maxRetries int, minBackoff, maxBackoff time.Duration) {
+	s.maxRetries = maxRetries
+	s.minBackoff, s.maxBackoff = minBackoff, maxBackoff
+}
+
+// SetClock sets the clock that is used to wait between retries. By default, the system clock is used.
+func (s *HTTPSink[T]) SetClock(clock Clock) {
+	s.clock = clock
+}
+
+// SetFailureHandler sets the function that receives each batch that could not be sent, along with the reason. The function is called by Write before the error is returned.
+func (s *HTTPSink[T]) SetFailureHandler(onFailure func(batch []T, err error)) {
+	s.onFailure = onFailure
+}
+
+/*
+Write encodes a batch and sends it to the URL, retrying failed requests (see SetRetry). If the batch is empty, then no request is sent.
+
+If the batch cannot be sent, then it is passed to the failure handler (see SetFailureHandler) and the error is returned; responses that are not successful return an error wrapping ErrHTTPStatus. If ctx is cancelled, then waiting stops and the error of ctx is returned.
+*/
+func (s *HTTPSink[T]) Write(ctx context.Context, batch []T) error {
+	if len(batch) == 0 {
+		return nil
+	}
+
+	err := s.send(ctx, batch)
+	if err != nil && s.onFailure != nil {
+		s.onFailure(batch, err)
+	}
+
+	return err
+}
+
+// Flush sends a batch with a background context. Errors are passed to the failure handler (see SetFailureHandler). It can be used as the flush handler of an AutoFlusher or Keyed aggregate.
+func (s *HTTPSink[T]) Flush(batch []T) {
+	_ = s.Write(context.Background(), batch)
+}
+
+// send encodes a batch and sends it until it succeeds, fails permanently, or runs out of retries.
+func (s *HTTPSink[T]) send(ctx context.Context, batch []T) error {
+	body, err := s.encode(batch)
+	if err != nil {
+		return err
+	}
+
+	for attempt := 0; ; attempt++ {
+		retry, delay, err := s.post(ctx, body)
+		if err == nil || !retry || attempt >= s.maxRetries {
+			return err
+		}
+
+		// the server does not allow a retry within the maximum backoff, so the batch fails instead of being retried early.
+		if delay > s.maxBackoff {
+			return fmt.Errorf("%w (retry after %v)", err, delay)
+		}
+
+		if backoff := s.backoff(attempt); delay < backoff {
+			delay = backoff
+		}
+
+		if err := s.wait(ctx, delay); err != nil {
+			return err
+		}
+	}
+}
+
+// encode encodes a batch, compressing it if gzip is enabled.
+func (s *HTTPSink[T]) encode(batch []T) ([]byte, error) {
+	b, err := s.enc.encode(s.buf[:0], batch)
+	s.buf = b
+	if err != nil || !s.gzip {
+		return b, err
+	}
+
+	out := bytes.NewBuffer(s.gzbuf[:0])
+	if s.gz == nil {
+		s.gz = gzip.NewWriter(out)
+	} else {
+		s.gz.Reset(out)
+	}
+
+	if _, err := s.gz.Write(b); err != nil {
+		return nil, err
+	}
+
+	if err := s.gz.Close(); err != nil {
+		return nil, err
+	}
+
+	s.gzbuf = out.Bytes()
+	return s.gzbuf, nil
+}
+
+// post sends one request. If the request failed, then it returns whether the request should be retried and the delay requested by the server, which is negative if the server did not request one.
+func (s *HTTPSink[T]) post(ctx context.Context, body []byte) (bool, time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return false, -1, err
+	}
+
+	// headers set with SetHeader take precedence over the content type of the sink.
+	if s.contentType != "" {
+		req.Header.Set("Content-Type", s.contentType)
+	}
+
+	for key, values := range s.header {
+		req.Header[key] = values
+	}
+
+	if s.gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		// requests that fail because ctx was cancelled are not retried.
+		return ctx.Err() == nil, -1, err
+	}
+
+	// the body is drained so that the connection can be reused.
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxDrain))
+	resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, -1, nil
+	}
+
+	err = fmt.Errorf("%w: %s", ErrHTTPStatus, resp.Status)
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode < 500 {
+		return false, -1, err
+	}
+
+	return true, s.retryAfter(resp.Header.Get("Retry-After")), err
+}
+
+// retryAfter returns the delay of a Retry-After header, which is either a number of seconds or an HTTP date. If the header is missing or invalid, then a negative delay is returned.
+func (s *HTTPSink[T]) retryAfter(value string) time.Duration {
+	if value == "" {
+		return -1
+	}
+
+	var delay time.Duration
+	if secs, err := strconv.Atoi(value); err == nil {
+		delay = time.Duration(secs) * time.Second
+	} else if t, err := http.ParseTime(value); err == nil {
+		delay = t.Sub(s.clock.Now())
+	} else {
+		return -1
+	}
+
+	if delay < 0 {
+		delay = 0
+	}
+
+	return delay
+}
+
+// backoff returns the randomized backoff before a retry.
+func (s *HTTPSink[T]) backoff(attempt int) time.Duration {
+	d := s.minBackoff
+	for i := 0; i < attempt && d < s.maxBackoff; i++ {
+		d *= 2
+	}
+
+	if d > s.maxBackoff {
+		d = s.maxBackoff
+	}
+
+	if d <= 0 {
+		return 0
+	}
+
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// sleep waits for d on the clock of the sink or until ctx is cancelled.
+func (s *HTTPSink[T]) sleep(ctx context.Context, d time.Duration) error {
+	done := make(chan struct{})
+	stop := s.clock.AfterFunc(d, func() { close(done) })
+	defer stop()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// StringsHTTPSink creates an HTTPSink that sends batches of strings to url. See HTTPSink.New.
+func StringsHTTPSink(url, contentType string, framing Framing) *HTTPSink[string] {
+	s := &HTTPSink[string]{}
+	s.New(url, contentType, framing, marshalString)
+
+	return s
+}
+
+// BytesHTTPSink creates an HTTPSink that sends batches of bytes to url. See HTTPSink.New.
+func BytesHTTPSink(url, contentType string, framing Framing) *HTTPSink[[]byte] {
+	s := &HTTPSink[[]byte]{}
+	s.New(url, contentType, framing, marshalBytes)
+
+	return s
+}
+
+// JSONHTTPSink creates an HTTPSink that sends batches of marshaled JSON objects to url, either as newline delimited JSON (NDJSONFraming) or as a JSON array (JSONArrayFraming). Objects are sent as they are, so the marshaled form kept by a JSON aggregate is not marshaled again; use JSON.EncodedFlush to flush a JSON aggregate to the HTTPSink. The Content-Type header is set to match the framing. See HTTPSink.New.
+func JSONHTTPSink(url string, framing Framing) *HTTPSink[[]byte] {
+	contentType := "application/x-ndjson"
+	if bytes.Equal(framing.Prefix, JSONArrayFraming.Prefix) {
+		contentType = "application/json"
+	}
+
+	s := &HTTPSink[[]byte]{}
+	s.New(url, contentType, framing, marshalBytes)
+
+	return s
+}
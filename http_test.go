@@ -0,0 +1,282 @@
+package aggregate
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jshlbrd/go-aggregate/aggregatetest"
+)
+
+// testServer responds to each request with the next status and records the bodies of the requests.
+type testServer struct {
+	mu       sync.Mutex
+	statuses []int
+	header   http.Header
+	bodies   []string
+	headers  []http.Header
+}
+
+func (s *testServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	body := io.Reader(r.Body)
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		body = gz
+	}
+
+	b, _ := io.ReadAll(body)
+	s.bodies = append(s.bodies, string(b))
+	s.headers = append(s.headers, r.Header.Clone())
+
+	status := http.StatusOK
+	if len(s.statuses) > 0 {
+		status, s.statuses = s.statuses[0], s.statuses[1:]
+	}
+
+	for key, values := range s.header {
+		w.Header()[key] = values
+	}
+	w.WriteHeader(status)
+}
+
+// noWait records the waits between retries without waiting.
+func noWait(waits *[]time.Duration) func(context.Context, time.Duration) error {
+	return func(_ context.Context, d time.Duration) error {
+		*waits = append(*waits, d)
+		return nil
+	}
+}
+
+func TestHTTPSink(t *testing.T) {
+	var tests = []struct {
+		name        string
+		framing     Framing
+		gzip        bool
+		expected    string
+		contentType string
+	}{
+		{
+			"ndjson",
+			NDJSONFraming,
+			false,
+			"{\"a\":1}\n{\"b\":2}\n",
+			"application/x-ndjson",
+		},
+		{
+			"array",
+			JSONArrayFraming,
+			true,
+			`[{"a":1},{"b":2}]`,
+			"application/json",
+		},
+	}
+
+	for _, test := range tests {
+		ts := &testServer{}
+		srv := httptest.NewServer(ts)
+
+		s := JSONHTTPSink(srv.URL, test.framing)
+		s.SetGzip(test.gzip)
+		s.SetHeader("Authorization", "Bearer token")
+
+		if err := s.Write(context.Background(), [][]byte{[]byte(`{"a":1}`), []byte(`{"b":2}`)}); err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.name, err)
+		}
+		srv.Close()
+
+		if len(ts.bodies) != 1 || ts.bodies[0] != test.expected {
+			t.Logf("%s: expected %q, got %q", test.name, test.expected, ts.bodies)
+			t.Fail()
+		}
+
+		h := ts.headers[0]
+		if h.Get("Content-Type") != test.contentType || h.Get("Authorization") != "Bearer token" {
+			t.Logf("%s: unexpected headers: %v", test.name, h)
+			t.Fail()
+		}
+	}
+}
+
+func TestHTTPSinkRetry(t *testing.T) {
+	var tests = []struct {
+		name      string
+		statuses  []int
+		header    http.Header
+		requests  int
+		waits     []time.Duration
+		permanent bool
+	}{
+		{
+			"success after retries",
+			[]int{503, 429, 200},
+			nil,
+			3,
+			nil,
+			false,
+		},
+		{
+			"client error",
+			[]int{400},
+			nil,
+			1,
+			nil,
+			true,
+		},
+		{
+			"retries exhausted",
+			[]int{500, 500, 500, 500},
+			nil,
+			4,
+			nil,
+			true,
+		},
+		{
+			"retry after",
+			[]int{429, 429, 200},
+			http.Header{"Retry-After": {"2"}},
+			3,
+			[]time.Duration{2 * time.Second, 2 * time.Second},
+			false,
+		},
+		{
+			"retry after longer than max backoff",
+			[]int{429, 200},
+			http.Header{"Retry-After": {"120"}},
+			1,
+			nil,
+			true,
+		},
+	}
+
+	for _, test := range tests {
+		ts := &testServer{statuses: test.statuses, header: test.header}
+		srv := httptest.NewServer(ts)
+
+		var failed []string
+		var waits []time.Duration
+		s := StringsHTTPSink(srv.URL, "text/plain", NDJSONFraming)
+		s.SetRetry(3, time.Second, 10*time.Second)
+		s.SetFailureHandler(func(batch []string, err error) {
+			failed = append(failed, batch...)
+		})
+		s.wait = noWait(&waits)
+
+		err := s.Write(context.Background(), []string{"foo"})
+		srv.Close()
+
+		if len(ts.bodies) != test.requests {
+			t.Logf("%s: expected %v requests, got %v", test.name, test.requests, len(ts.bodies))
+			t.Fail()
+		}
+
+		if test.permanent != (err != nil) || test.permanent != (len(failed) == 1) {
+			t.Logf("%s: expected permanent failure %v, got %v and %v", test.name, test.permanent, err, failed)
+			t.Fail()
+		}
+
+		if err != nil && !errors.Is(err, ErrHTTPStatus) {
+			t.Logf("%s: expected %v, got %v", test.name, ErrHTTPStatus, err)
+			t.Fail()
+		}
+
+		for i, expected := range test.waits {
+			if i >= len(waits) || waits[i] != expected {
+				t.Logf("%s: expected waits %v, got %v", test.name, test.waits, waits)
+				t.Fail()
+				break
+			}
+		}
+	}
+}
+
+func TestHTTPSinkBackoff(t *testing.T) {
+	s := BytesHTTPSink("http://localhost", "application/octet-stream", Framing{})
+	s.SetRetry(10, 100*time.Millisecond, time.Second)
+
+	var tests = []struct {
+		attempt  int
+		min, max time.Duration
+	}{
+		{0, 50 * time.Millisecond, 100 * time.Millisecond},
+		{1, 100 * time.Millisecond, 200 * time.Millisecond},
+		{3, 400 * time.Millisecond, 800 * time.Millisecond},
+		{4, 500 * time.Millisecond, time.Second},
+		{100, 500 * time.Millisecond, time.Second},
+	}
+
+	for _, test := range tests {
+		for i := 0; i < 100; i++ {
+			if d := s.backoff(test.attempt); d < test.min || d > test.max {
+				t.Fatalf("attempt %v: expected a backoff between %v and %v, got %v", test.attempt, test.min, test.max, d)
+			}
+		}
+	}
+}
+
+func TestHTTPSinkCancel(t *testing.T) {
+	ts := &testServer{statuses: []int{503, 503}}
+	srv := httptest.NewServer(ts)
+	defer srv.Close()
+
+	clock := aggregatetest.NewClock(time.Unix(0, 0))
+	s := StringsHTTPSink(srv.URL, "text/plain", NDJSONFraming)
+	s.SetClock(clock)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- s.Write(ctx, []string{"foo"}) }()
+
+	// the sink waits on the clock for the backoff before the first retry.
+	for clock.Timers() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+
+	if err := <-done; err != context.Canceled {
+		t.Logf("expected %v, got %v", context.Canceled, err)
+		t.Fail()
+	}
+}
+
+func TestHTTPSinkFlusher(t *testing.T) {
+	ts := &testServer{}
+	srv := httptest.NewServer(ts)
+	defer srv.Close()
+
+	agg := JSON{}
+	agg.New(2, 1000, time.Minute)
+
+	s := JSONHTTPSink(srv.URL, NDJSONFraming)
+	f := AutoFlusher[interface{}]{}
+	f.New(&agg, agg.EncodedFlush(s.Flush))
+
+	for i := 0; i < 5; i++ {
+		f.Add(map[string]int{"i": i})
+	}
+	f.Close()
+
+	expected := []string{"{\"i\":0}\n{\"i\":1}\n", "{\"i\":2}\n{\"i\":3}\n", "{\"i\":4}\n"}
+	if len(ts.bodies) != len(expected) {
+		t.Fatalf("expected %v requests, got %v", len(expected), len(ts.bodies))
+	}
+
+	for i := range expected {
+		if ts.bodies[i] != expected[i] {
+			t.Logf("expected %q, got %q", expected[i], ts.bodies[i])
+			t.Fail()
+		}
+	}
+}
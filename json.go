@@ -8,14 +8,13 @@ import (
 // InvalidJSON is returned when an invalid JSON object is added to the aggregate.
 const InvalidJSON = Error("InvalidJSON")
 
-// JSON is an intermediary structure for storing structs that marshal to valid JSON.
+// JSON is an intermediary structure for storing structs that marshal to valid JSON. The marshaled form of each object is kept so that it does not need to be marshaled again when the payload is retrieved.
 type JSON struct {
-	count, maxCount int
-	size, maxSize   int
-	maxDuration     time.Duration
+	Aggregate[interface{}]
 
-	now   time.Time
-	items []interface{}
+	// pending is the marshaled form of the object that is being added.
+	pending []byte
+	encoded [][]byte
 }
 
 /*
@@ -25,87 +24,118 @@ New initializes a new JSON aggregate with these settings:
 	maxSize:
 		the maximum size of all JSON objects stored in the aggregate; when this value is reached, no more objects can be added to the payload.
 	maxDuration:
-		the maximum duration that the aggregate will store JSON objects; when this duration is reached, no more objects can be added to the payload.
+		the maximum duration that the aggregate will store JSON objects, measured from when the first item was added; when this duration is reached, no more objects can be added to the payload.
 */
 func (a *JSON) New(maxCount, maxSize int, maxDuration time.Duration) {
-	a.count, a.size = 0, 0
-	a.maxCount = maxCount
-	a.maxSize = maxSize
-	a.maxDuration = maxDuration
+	a.Aggregate.New(maxCount, maxSize, maxDuration, a.marshal)
 
-	a.now = time.Now()
-	a.items = make([]interface{}, 0, a.maxCount)
+	a.pending = nil
+	a.encoded = make([][]byte, 0, initialCapacity(maxCount))
 }
 
 // Reset resets a JSON aggregate to its initialized settings.
 func (a *JSON) Reset() {
-	a.count, a.size = 0, 0
+	a.Aggregate.Reset()
 
-	a.now = time.Now()
-	a.items = a.items[:0]
+	a.encoded = a.encoded[:0]
 }
 
-/*
-Add adds a JSON object to the aggregate payload, returning true if the add succeeded and false if the add failed. If an invalid JSON object is added, then an error is returned.
+// Add adds a JSON object to the aggregate payload. If the object cannot be marshaled or is not a valid JSON object, then an error is returned. See Aggregate.Add for the other errors that are returned.
+func (a *JSON) Add(data interface{}) error {
+	err := a.Aggregate.Add(data)
+	if err == nil {
+		a.encoded = append(a.encoded, a.pending)
+	}
 
-If an add attempt fails and the payload is not empty, then the payload should be retrieved (see Get), the aggregate reset (see Reset), and the failed object should be reattempted.
+	a.pending = nil
+	return err
+}
 
-If an add attempt fails and the payload is empty, then the object being added exceeds the configured limits of the aggregate and should not be reattempted.
-*/
-func (a *JSON) Add(data interface{}) (bool, error) {
-	newCount := a.count + 1
-	if newCount > a.maxCount {
-		return false, nil
-	}
+// SetWAL sets the write-ahead log that the marshaled form of every JSON object added to the aggregate is appended to. Objects recovered from the log are added as json.RawMessage. See Aggregate.SetWAL and Aggregate.Recover.
+func (a *JSON) SetWAL(wal *WAL) {
+	a.Aggregate.SetWAL(wal, func(interface{}) []byte { return a.pending }, jsonDecode)
+}
 
-	size, err := jsonSize(data)
+// Recover adds the JSON objects stored in the write-ahead log to the aggregate. See Aggregate.Recover.
+func (a *JSON) Recover(flush func([]interface{})) error {
+	return a.Aggregate.recover(a, flush)
+}
+
+// MarshalBinary captures the state of the aggregate, including the marshaled form of the payload, counters, limits, and the time when the first item was added. It implements encoding.BinaryMarshaler.
+func (a *JSON) MarshalBinary() ([]byte, error) {
+	return a.snapshot(a.encoded, nil).marshal(), nil
+}
+
+// UnmarshalBinary initializes the aggregate and restores the state captured by MarshalBinary. Restored objects are added as json.RawMessage. Settings that refer to local resources, such as the write-ahead log, are not restored. It implements encoding.BinaryUnmarshaler.
+func (a *JSON) UnmarshalBinary(b []byte) error {
+	s, err := unmarshalSnapshot(b)
 	if err != nil {
-		return false, err
+		return err
 	}
 
-	newSize := a.size + size
-	if newSize > a.maxSize {
-		return false, nil
+	a.New(s.maxCount, s.maxSize, s.maxDuration)
+	for _, r := range s.items {
+		a.Aggregate.append(json.RawMessage(r), len(r))
+		a.encoded = append(a.encoded, r)
 	}
 
-	if time.Since(a.now) > a.maxDuration {
-		return false, nil
-	}
+	a.restore(s, jsonDecode)
+	return nil
+}
 
-	a.size = newSize
-	a.count = newCount
+// GetEncoded returns the marshaled form of each JSON object in the aggregate payload.
+func (a *JSON) GetEncoded() [][]byte {
+	return a.encoded
+}
 
-	a.now = time.Now()
-	a.items = append(a.items, data)
+// EncodedFlush returns a flush handler that passes the marshaled form of each payload (see GetEncoded) to flush instead of the objects, so that they are not marshaled again; for example, the Flush method of a JSONSink or JSONHTTPSink. It can be used as the flush handler of an AutoFlusher that wraps the aggregate, which calls the handler before the aggregate is reset.
+func (a *JSON) EncodedFlush(flush func([][]byte)) func([]interface{}) {
+	return func([]interface{}) {
+		flush(a.encoded)
+	}
+}
 
-	return true, nil
+// Encode returns the aggregate payload encoded with the framing of the aggregate (see SetFraming). The objects are marshaled when they are added, so the error is always nil; it is returned so that Encode has the same signature as Strings.Encode and Bytes.Encode.
+func (a *JSON) Encode() ([]byte, error) {
+	return appendFramed(a.framing, make([]byte, 0, a.Size()), a.encoded), nil
 }
 
-// Get returns the aggregate payload.
-func (a *JSON) Get() []interface{} {
-	return a.items
+// NDJSON returns the aggregate payload as newline delimited JSON, with each object terminated by a newline.
+func (a *JSON) NDJSON() []byte {
+	return appendFramed(NDJSONFraming, make([]byte, 0, NDJSONFraming.Size(a.count, a.size)), a.encoded)
 }
 
-// Count returns the number of JSON objects in the aggregate payload.
-func (a *JSON) Count() int {
-	return a.count
+// Array returns the aggregate payload as a JSON array.
+func (a *JSON) Array() []byte {
+	return appendFramed(JSONArrayFraming, make([]byte, 0, JSONArrayFraming.Size(a.count, a.size)), a.encoded)
 }
 
-// Size returns the total size of the JSON objects in the aggregate payload.
-func (a *JSON) Size() int {
-	return a.size
+// marshal marshals a JSON object and keeps the marshaled form until the add attempt completes.
+func (a *JSON) marshal(v interface{}) (int, error) {
+	b, err := jsonMarshal(v)
+	if err != nil {
+		return 0, err
+	}
+
+	a.pending = b
+	return len(b), nil
 }
 
-// size calculates the size of a JSON object. If the attempt to marshal the JSON fails or if the object is not a valid JSON object, then an error is returned.
-func jsonSize(v interface{}) (int, error) {
+// jsonMarshal marshals a JSON object. If the attempt to marshal the JSON fails or if the object is not a valid JSON object, then an error is returned.
+func jsonMarshal(v interface{}) ([]byte, error) {
 	b, err := json.Marshal(v)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
 	if !json.Valid(b) {
-		return 0, InvalidJSON
+		return nil, InvalidJSON
 	}
 
-	return len(b), nil
+	return b, nil
+}
+
+// jsonDecode converts the marshaled form of a JSON object into a json.RawMessage.
+func jsonDecode(b []byte) interface{} {
+	return json.RawMessage(b)
 }
@@ -5,10 +5,12 @@ import (
 	"encoding/json"
 	"testing"
 	"time"
+
+	"github.com/jshlbrd/go-aggregate/aggregatetest"
 )
 
 // TestJSONTimeout tests that the timeout is respected by configuring
-// a timeout of 1ms and sleeping for 1ms between each Add() call.
+// a timeout of 1ms and advancing the clock by 2ms between each Add() call.
 func TestJSONTimeout(t *testing.T) {
 	var tests = []struct {
 		data     []interface{}
@@ -46,12 +48,14 @@ func TestJSONTimeout(t *testing.T) {
 			t.Fail()
 		}
 
+		clock := aggregatetest.NewClock(time.Unix(0, 0))
 		agg := JSON{}
+		agg.SetClock(clock)
 		agg.New(100, 100, dur)
 
 		for _, data := range test.data {
 			agg.Add(data)
-			time.Sleep(1 * time.Millisecond)
+			clock.Advance(2 * time.Millisecond)
 		}
 
 		if agg.Count() != test.expected {
@@ -307,3 +311,90 @@ func BenchmarkJSON(b *testing.B) {
 		)
 	}
 }
+
+func TestJSONEncoded(t *testing.T) {
+	var tests = []struct {
+		data    []interface{}
+		ndjson  string
+		array   string
+		encoded []string
+	}{
+		{
+			[]interface{}{
+				map[string]interface{}{"foo": "bar"},
+				[]int{1, 2},
+			},
+			"{\"foo\":\"bar\"}\n[1,2]\n",
+			`[{"foo":"bar"},[1,2]]`,
+			[]string{
+				`{"foo":"bar"}`,
+				`[1,2]`,
+			},
+		},
+		{
+			[]interface{}{},
+			"",
+			`[]`,
+			[]string{},
+		},
+	}
+
+	for _, test := range tests {
+		agg := JSON{}
+		agg.New(100, 100, time.Minute)
+		for _, data := range test.data {
+			agg.Add(data)
+		}
+
+		// objects that fail to be added must not be kept.
+		agg.Add(make(chan int))
+
+		encoded := agg.GetEncoded()
+		if len(encoded) != len(test.encoded) {
+			t.Fatalf("expected %v, got %v", len(test.encoded), len(encoded))
+		}
+
+		for i, e := range encoded {
+			if string(e) != test.encoded[i] {
+				t.Logf("expected %v, got %v", test.encoded[i], string(e))
+				t.Fail()
+			}
+		}
+
+		if string(agg.NDJSON()) != test.ndjson {
+			t.Logf("expected %v, got %v", test.ndjson, string(agg.NDJSON()))
+			t.Fail()
+		}
+
+		if string(agg.Array()) != test.array {
+			t.Logf("expected %v, got %v", test.array, string(agg.Array()))
+			t.Fail()
+		}
+
+		agg.Reset()
+		if len(agg.GetEncoded()) != 0 {
+			t.Logf("expected %v, got %v", 0, len(agg.GetEncoded()))
+			t.Fail()
+		}
+	}
+}
+
+func TestJSONDeadLetter(t *testing.T) {
+	agg := JSON{}
+	agg.New(100, 100, time.Minute)
+
+	var reason error
+	agg.SetDeadLetter(func(data interface{}, err error) {
+		reason = err
+	})
+
+	if err := agg.Add(make(chan int)); err == nil || err != reason {
+		t.Logf("expected %v, got %v", reason, err)
+		t.Fail()
+	}
+
+	if agg.DeadLetterCount() != 1 || agg.Count() != 0 {
+		t.Logf("expected %v, got %v", 1, agg.DeadLetterCount())
+		t.Fail()
+	}
+}
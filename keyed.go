@@ -0,0 +1,167 @@
+package aggregate
+
+import "container/list"
+
+// Keyed is an intermediary structure that stores items in a separate aggregate for each partition key. Partitions are created when their first item is added and removed when they are flushed.
+type Keyed[K comparable, T any] struct {
+	newAgg        func() Aggregator[T]
+	flush         func(K, []T)
+	size, maxSize int
+
+	partitions map[K]*list.Element
+	// lru orders partitions from the most recently used (front) to the least recently used (back).
+	lru *list.List
+}
+
+// partition is the aggregate for a single partition key.
+type partition[K comparable, T any] struct {
+	key K
+	agg Aggregator[T]
+}
+
+/*
+New initializes a new Keyed aggregate with these settings:
+	newAgg:
+		the function used to create the aggregate for each partition; every aggregate should be created with the same limits.
+	flush:
+		the function that receives the payload of each partition; the payload is only valid until the function returns.
+	maxSize:
+		the maximum size of all items stored across all partitions; when this value is exceeded, the least recently used partitions are flushed until the total size is within the limit. A value of zero disables the limit.
+*/
+func (a *Keyed[K, T]) New(newAgg func() Aggregator[T], flush func(K, []T), maxSize int) {
+	a.newAgg = newAgg
+	a.flush = flush
+	a.size, a.maxSize = 0, maxSize
+
+	a.partitions = make(map[K]*list.Element)
+	a.lru = list.New()
+}
+
+/*
+Add adds an item to the aggregate of a partition. If the aggregate is full or has expired, then the partition is flushed and the item is reattempted.
+
+If the item can never be added to the aggregate, then the error returned by the aggregate is returned.
+*/
+func (a *Keyed[K, T]) Add(key K, data T) error {
+	e, ok := a.partitions[key]
+	if !ok {
+		agg := a.newAgg()
+		a.size += agg.Size()
+
+		e = a.lru.PushFront(&partition[K, T]{key: key, agg: agg})
+		a.partitions[key] = e
+	}
+	a.lru.MoveToFront(e)
+
+	p := e.Value.(*partition[K, T])
+	before := p.agg.Size()
+
+	err := p.agg.Add(data)
+	switch err {
+	case ErrCountExceeded, ErrSizeExceeded, ErrExpired, ErrIdle:
+		for p.agg.Count() > 0 {
+			a.flush(key, p.agg.Get())
+			p.agg.Reset()
+		}
+
+		err = p.agg.Add(data)
+	}
+
+	a.size += p.agg.Size() - before
+	if p.agg.Count() == 0 {
+		a.remove(e)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	for a.maxSize > 0 && a.size > a.maxSize && a.lru.Len() > 0 {
+		a.evict(a.lru.Back())
+	}
+
+	return nil
+}
+
+// FlushKey flushes the partition of a key. If the partition does not exist, then the flush function is not called.
+func (a *Keyed[K, T]) FlushKey(key K) {
+	if e, ok := a.partitions[key]; ok {
+		a.evict(e)
+	}
+}
+
+// FlushExpired flushes every partition whose payload has expired. Partitions are only checked for expiration when items are added to them, so this should be called periodically.
+func (a *Keyed[K, T]) FlushExpired() {
+	for e := a.lru.Back(); e != nil; {
+		prev := e.Prev()
+		if e.Value.(*partition[K, T]).agg.Expired() != nil {
+			a.evict(e)
+		}
+		e = prev
+	}
+}
+
+// Flush flushes every partition, from the least recently used to the most recently used.
+func (a *Keyed[K, T]) Flush() {
+	for a.lru.Len() > 0 {
+		a.evict(a.lru.Back())
+	}
+}
+
+// Keys returns the partition keys, from the most recently used to the least recently used.
+func (a *Keyed[K, T]) Keys() []K {
+	keys := make([]K, 0, a.lru.Len())
+	for e := a.lru.Front(); e != nil; e = e.Next() {
+		keys = append(keys, e.Value.(*partition[K, T]).key)
+	}
+
+	return keys
+}
+
+// Count returns the number of items in the payload of a partition.
+func (a *Keyed[K, T]) Count(key K) int {
+	if e, ok := a.partitions[key]; ok {
+		return e.Value.(*partition[K, T]).agg.Count()
+	}
+
+	return 0
+}
+
+// Size returns the size of the payload of a partition.
+func (a *Keyed[K, T]) Size(key K) int {
+	if e, ok := a.partitions[key]; ok {
+		return e.Value.(*partition[K, T]).agg.Size()
+	}
+
+	return 0
+}
+
+// TotalSize returns the size of the payloads of all partitions.
+func (a *Keyed[K, T]) TotalSize() int {
+	return a.size
+}
+
+// evict flushes and removes a partition.
+func (a *Keyed[K, T]) evict(e *list.Element) {
+	p := e.Value.(*partition[K, T])
+
+	before := p.agg.Size()
+	for p.agg.Count() > 0 {
+		a.flush(p.key, p.agg.Get())
+		p.agg.Reset()
+	}
+	a.size += p.agg.Size() - before
+
+	a.remove(e)
+}
+
+// remove resets and removes a partition without flushing it.
+func (a *Keyed[K, T]) remove(e *list.Element) {
+	p := e.Value.(*partition[K, T])
+
+	a.size -= p.agg.Size()
+	p.agg.Reset()
+
+	a.lru.Remove(e)
+	delete(a.partitions, p.key)
+}
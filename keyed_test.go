@@ -0,0 +1,120 @@
+package aggregate
+
+import (
+	"testing"
+	"time"
+)
+
+func newKeyedStrings(maxCount, maxSize int) func() Aggregator[string] {
+	return func() Aggregator[string] {
+		agg := Strings{}
+		agg.New(maxCount, maxSize, time.Minute)
+		return &agg
+	}
+}
+
+func TestKeyedAdd(t *testing.T) {
+	var tests = []struct {
+		keys     []string
+		data     []string
+		expected map[string][][]string
+	}{
+		{
+			[]string{"a", "b", "a", "a", "b"},
+			[]string{"foo", "bar", "baz", "qux", "quux"},
+			map[string][][]string{
+				"a": {{"foo", "baz"}, {"qux"}},
+				"b": {{"bar", "quux"}},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		flushed := make(map[string][][]string)
+		agg := Keyed[string, string]{}
+		agg.New(newKeyedStrings(2, 100), func(key string, batch []string) {
+			flushed[key] = append(flushed[key], append([]string(nil), batch...))
+		}, 0)
+
+		for i, data := range test.data {
+			if err := agg.Add(test.keys[i], data); err != nil {
+				t.Logf("unexpected error: %v", err)
+				t.Fail()
+			}
+		}
+
+		if agg.Count("a") != 1 || agg.Count("b") != 2 || agg.Size("b") != 7 {
+			t.Logf("expected counts 1 and 2, got %v and %v", agg.Count("a"), agg.Count("b"))
+			t.Fail()
+		}
+
+		agg.Flush()
+		for key, batches := range test.expected {
+			if len(flushed[key]) != len(batches) {
+				t.Fatalf("expected %v, got %v", batches, flushed[key])
+			}
+
+			for i, batch := range batches {
+				for j, item := range batch {
+					if flushed[key][i][j] != item {
+						t.Logf("expected %v, got %v", item, flushed[key][i][j])
+						t.Fail()
+					}
+				}
+			}
+		}
+
+		if agg.TotalSize() != 0 || len(agg.Keys()) != 0 {
+			t.Logf("expected no partitions, got %v", agg.Keys())
+			t.Fail()
+		}
+	}
+}
+
+// TestKeyedMaxSize tests that the least recently used partitions are flushed when the total size is exceeded.
+func TestKeyedMaxSize(t *testing.T) {
+	var flushed []string
+	agg := Keyed[string, string]{}
+	agg.New(newKeyedStrings(100, 100), func(key string, batch []string) {
+		flushed = append(flushed, key)
+	}, 10)
+
+	agg.Add("a", "foo")
+	agg.Add("b", "bar")
+	agg.Add("a", "baz")
+	agg.Add("c", "qux")
+
+	if len(flushed) != 1 || flushed[0] != "b" {
+		t.Logf("expected %v, got %v", []string{"b"}, flushed)
+		t.Fail()
+	}
+
+	if agg.TotalSize() != 9 {
+		t.Logf("expected %v, got %v", 9, agg.TotalSize())
+		t.Fail()
+	}
+
+	keys := agg.Keys()
+	if len(keys) != 2 || keys[0] != "c" || keys[1] != "a" {
+		t.Logf("expected %v, got %v", []string{"c", "a"}, keys)
+		t.Fail()
+	}
+}
+
+func TestKeyedItemTooLarge(t *testing.T) {
+	agg := Keyed[int, string]{}
+	agg.New(newKeyedStrings(100, 3), func(key int, batch []string) {
+		t.Log("unexpected flush")
+		t.Fail()
+	}, 0)
+
+	if err := agg.Add(1, "foobar"); err != ErrItemTooLarge {
+		t.Logf("expected %v, got %v", ErrItemTooLarge, err)
+		t.Fail()
+	}
+
+	if len(agg.Keys()) != 0 {
+		t.Logf("expected no partitions, got %v", agg.Keys())
+		t.Fail()
+	}
+}
@@ -0,0 +1,196 @@
+package aggregate
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Trigger describes why a payload was flushed.
+type Trigger int
+
+const (
+	// TriggerManual is the trigger of a payload that was flushed before it was full or expired.
+	TriggerManual Trigger = iota
+	// TriggerCount is the trigger of a payload that held the maximum number of items.
+	TriggerCount
+	// TriggerSize is the trigger of a payload that could not fit the next item within the maximum size.
+	TriggerSize
+	// TriggerAge is the trigger of a payload that exceeded the maximum duration or the maximum idle duration.
+	TriggerAge
+)
+
+// triggers are all triggers, in the order they are exported.
+var triggers = []Trigger{TriggerCount, TriggerSize, TriggerAge, TriggerManual}
+
+func (t Trigger) String() string {
+	switch t {
+	case TriggerCount:
+		return "count"
+	case TriggerSize:
+		return "size"
+	case TriggerAge:
+		return "age"
+	default:
+		return "manual"
+	}
+}
+
+// triggerOf returns the trigger of a payload that caused err to be returned, or false if err does not mean that the payload is full or expired.
+func triggerOf(err error) (Trigger, bool) {
+	switch err {
+	case ErrCountExceeded:
+		return TriggerCount, true
+	case ErrSizeExceeded:
+		return TriggerSize, true
+	case ErrExpired, ErrIdle:
+		return TriggerAge, true
+	}
+
+	return TriggerManual, false
+}
+
+/*
+Metrics receives events that describe the batching behavior of an aggregate (see SetMetrics). ExpvarMetrics and PrometheusMetrics are ready-made implementations.
+
+Aggregates call Metrics while they are being used, so implementations that are shared by aggregates in different goroutines must be safe for concurrent use.
+*/
+type Metrics interface {
+	// Added is called when an item is added to the payload, with the size of the item as calculated by the Sizer of the aggregate. The size does not include any framing or compression, so it is never negative.
+	Added(size int)
+	// Rejected is called when an item is not added to the payload, with the reason it was rejected. Items that are reattempted after the payload is flushed are rejected once for each failed attempt.
+	Rejected(reason error)
+	// Flushed is called when a non-empty payload is reset, with the trigger of the flush, the number of items and size of the payload, and how long the payload was open.
+	Flushed(trigger Trigger, count, size int, open time.Duration)
+}
+
+// SetMetrics sets the Metrics that receive the events of the aggregate. The trigger of each flush is the reason that the last add attempt failed or that Expired last reported, or TriggerManual if the payload is reset before it is full or expired.
+func (a *Aggregate[T]) SetMetrics(m Metrics) {
+	a.metrics = m
+}
+
+// observeAdd reports the result of an add attempt for an item of size to the Metrics of the aggregate.
+func (a *Aggregate[T]) observeAdd(size int, err error) {
+	if err == nil {
+		a.metrics.Added(size)
+		return
+	}
+
+	a.metrics.Rejected(err)
+}
+
+// observeFlush reports the payload that is being reset to the Metrics of the aggregate.
+func (a *Aggregate[T]) observeFlush() {
+	if a.count == 0 {
+		return
+	}
+
+	a.metrics.Flushed(a.trigger, a.count, a.Size(), a.clock.Now().Sub(a.start))
+}
+
+var (
+	// countBuckets are the upper bounds of the histogram of the number of items in each payload.
+	countBuckets = []float64{1, 10, 100, 1000, 10000, 100000}
+	// sizeBuckets are the upper bounds of the histogram of the size of each payload.
+	sizeBuckets = []float64{1 << 10, 1 << 12, 1 << 14, 1 << 16, 1 << 18, 1 << 20, 1 << 22, 1 << 24, 1 << 26}
+	// openBuckets are the upper bounds, in seconds, of the histogram of how long each payload was open.
+	openBuckets = []float64{0.001, 0.01, 0.1, 1, 10, 60, 600}
+)
+
+// histogram counts observations in buckets with fixed upper bounds.
+type histogram struct {
+	bounds []float64
+	// counts holds the number of observations in each bucket, with an additional bucket for observations above the last bound.
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func newHistogram(bounds []float64) histogram {
+	return histogram{bounds: bounds, counts: make([]uint64, len(bounds)+1)}
+}
+
+func (h *histogram) observe(v float64) {
+	i := sort.SearchFloat64s(h.bounds, v)
+	h.counts[i]++
+	h.count++
+	h.sum += v
+}
+
+// cumulative returns the number of observations that are less than or equal to each bound.
+func (h *histogram) cumulative() []uint64 {
+	c := make([]uint64, len(h.bounds))
+	var n uint64
+	for i := range h.bounds {
+		n += h.counts[i]
+		c[i] = n
+	}
+
+	return c
+}
+
+// recorder implements Metrics by keeping counters and histograms in memory. It is safe for concurrent use and is shared by the exporters.
+type recorder struct {
+	mu sync.Mutex
+
+	added, addedSize uint64
+	rejected         map[string]uint64
+	flushes          map[Trigger]uint64
+
+	batchCount, batchSize, batchOpen histogram
+}
+
+func (r *recorder) init() {
+	r.added, r.addedSize = 0, 0
+	r.rejected = make(map[string]uint64)
+	r.flushes = make(map[Trigger]uint64)
+
+	r.batchCount = newHistogram(countBuckets)
+	r.batchSize = newHistogram(sizeBuckets)
+	r.batchOpen = newHistogram(openBuckets)
+}
+
+func (r *recorder) Added(size int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.added++
+	r.addedSize += uint64(size)
+}
+
+func (r *recorder) Rejected(reason error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.rejected[reasonOf(reason)]++
+}
+
+func (r *recorder) Flushed(trigger Trigger, count, size int, open time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.flushes[trigger]++
+	r.batchCount.observe(float64(count))
+	r.batchSize.observe(float64(size))
+	r.batchOpen.observe(open.Seconds())
+}
+
+// reasons returns the reasons that items were rejected, sorted by name. The caller must hold the lock.
+func (r *recorder) reasons() []string {
+	reasons := make([]string, 0, len(r.rejected))
+	for reason := range r.rejected {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+
+	return reasons
+}
+
+// reasonOf returns the name of the reason that an item was rejected. Errors that are not defined by this package, such as those returned by a Sizer, are named "other" so that the number of reasons is bounded.
+func reasonOf(err error) string {
+	if e, ok := err.(Error); ok {
+		return string(e)
+	}
+
+	return "other"
+}
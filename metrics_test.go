@@ -0,0 +1,207 @@
+package aggregate
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jshlbrd/go-aggregate/aggregatetest"
+)
+
+// testMetrics records the events that it receives.
+type testMetrics struct {
+	added    []int
+	rejected []error
+	flushes  []Trigger
+	counts   []int
+	open     []time.Duration
+}
+
+func (m *testMetrics) Added(size int) {
+	m.added = append(m.added, size)
+}
+
+func (m *testMetrics) Rejected(reason error) {
+	m.rejected = append(m.rejected, reason)
+}
+
+func (m *testMetrics) Flushed(trigger Trigger, count, size int, open time.Duration) {
+	m.flushes = append(m.flushes, trigger)
+	m.counts = append(m.counts, count)
+	m.open = append(m.open, open)
+}
+
+func TestMetricsTriggers(t *testing.T) {
+	var tests = []struct {
+		name     string
+		data     []string
+		advance  time.Duration
+		expected []Trigger
+	}{
+		{
+			"count",
+			[]string{"a", "b", "c", "d", "e"},
+			0,
+			[]Trigger{TriggerCount, TriggerCount, TriggerManual},
+		},
+		{
+			"size",
+			[]string{"aaaaa", "bbbbb", "ccccc"},
+			0,
+			[]Trigger{TriggerSize, TriggerSize, TriggerManual},
+		},
+		{
+			"age",
+			[]string{"a", "b"},
+			2 * time.Second,
+			[]Trigger{TriggerAge, TriggerManual},
+		},
+	}
+
+	for _, test := range tests {
+		clock := aggregatetest.NewClock(time.Unix(0, 0))
+		m := &testMetrics{}
+
+		agg := Strings{}
+		agg.SetClock(clock)
+		agg.New(2, 8, time.Second)
+		agg.SetMetrics(m)
+
+		for _, data := range test.data {
+			clock.Advance(test.advance)
+			if err := agg.Add(data); err != nil {
+				agg.Reset()
+				agg.Add(data)
+			}
+		}
+		agg.Reset()
+
+		if len(m.flushes) != len(test.expected) {
+			t.Fatalf("%s: expected %v, got %v", test.name, test.expected, m.flushes)
+		}
+
+		for i, trigger := range m.flushes {
+			if trigger != test.expected[i] {
+				t.Logf("%s: expected %v, got %v", test.name, test.expected[i], trigger)
+				t.Fail()
+			}
+		}
+
+		if len(m.added) != len(test.data) {
+			t.Logf("%s: expected %v added, got %v", test.name, len(test.data), len(m.added))
+			t.Fail()
+		}
+	}
+}
+
+func TestMetricsExpired(t *testing.T) {
+	clock := aggregatetest.NewClock(time.Unix(0, 0))
+	m := &testMetrics{}
+
+	agg := Bytes{}
+	agg.SetClock(clock)
+	agg.New(10, 100, time.Second)
+	agg.SetMetrics(m)
+
+	agg.Add([]byte("foo"))
+	clock.Advance(3 * time.Second)
+	if agg.Expired() == nil {
+		t.Fatal("expected the payload to be expired")
+	}
+	agg.Reset()
+
+	if len(m.flushes) != 1 || m.flushes[0] != TriggerAge {
+		t.Logf("expected %v, got %v", []Trigger{TriggerAge}, m.flushes)
+		t.Fail()
+	}
+
+	if len(m.open) != 1 || m.open[0] != 3*time.Second {
+		t.Logf("expected %v, got %v", 3*time.Second, m.open)
+		t.Fail()
+	}
+}
+
+func TestMetricsRejected(t *testing.T) {
+	m := &testMetrics{}
+
+	agg := JSON{}
+	agg.New(10, 15, time.Second)
+	agg.SetMetrics(m)
+
+	var tests = []struct {
+		data     interface{}
+		expected error
+	}{
+		{map[string]string{"a": "b"}, nil},
+		{map[string]string{"b": "c"}, ErrSizeExceeded},
+		{map[string]string{"foobarbaz": "qux"}, ErrItemTooLarge},
+		{make(chan int), nil},
+	}
+
+	for _, test := range tests {
+		agg.Add(test.data)
+	}
+
+	if len(m.added) != 1 || m.added[0] != 9 {
+		t.Logf("expected %v, got %v", []int{9}, m.added)
+		t.Fail()
+	}
+
+	if len(m.rejected) != 3 || m.rejected[0] != ErrSizeExceeded || m.rejected[1] != ErrItemTooLarge || reasonOf(m.rejected[2]) != "other" {
+		t.Logf("expected rejections by size, item size, and marshal error, got %v", m.rejected)
+		t.Fail()
+	}
+}
+
+// TestMetricsCompressed tests that the added size is never negative, even though the size of a compressed payload decreases when the compressor is flushed.
+func TestMetricsCompressed(t *testing.T) {
+	m := PrometheusMetrics{}
+	m.New("")
+
+	agg := Compressed[string]{}
+	agg.New(1000, 256, time.Minute, Gzip)
+	agg.SetFraming(NDJSONFraming)
+	agg.SetMetrics(&m)
+
+	var max int
+	var shrunk bool
+	item := strings.Repeat("a", 32)
+	for agg.Add(item) == nil {
+		if agg.Size() < max {
+			shrunk = true
+		}
+
+		if agg.Size() > max {
+			max = agg.Size()
+		}
+	}
+
+	if !shrunk {
+		t.Fatal("expected the size of the payload to decrease")
+	}
+
+	if m.added != uint64(agg.Count()) || m.addedSize != uint64(agg.Count()*len(item)) {
+		t.Logf("expected %v items with size %v, got %v items with size %v", agg.Count(), agg.Count()*len(item), m.added, m.addedSize)
+		t.Fail()
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	h := newHistogram([]float64{1, 10, 100})
+	for _, v := range []float64{0, 1, 5, 10, 50, 1000} {
+		h.observe(v)
+	}
+
+	expected := []uint64{2, 4, 5}
+	for i, n := range h.cumulative() {
+		if n != expected[i] {
+			t.Logf("expected %v, got %v", expected[i], n)
+			t.Fail()
+		}
+	}
+
+	if h.count != 6 || h.sum != 1066 {
+		t.Logf("expected count 6 and sum 1066, got %v and %v", h.count, h.sum)
+		t.Fail()
+	}
+}
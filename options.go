@@ -0,0 +1,367 @@
+package aggregate
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// ErrInvalidOption is returned when the options of an aggregate are invalid or contradict each other.
+const ErrInvalidOption = Error("ErrInvalidOption")
+
+// unlimitedDuration is the maximum duration of an aggregate that has no duration limit; a payload can never be stored longer than this.
+const unlimitedDuration = time.Duration(math.MaxInt64)
+
+// maxInitialCapacity is the largest number of items that is allocated for a payload before any items are added.
+const maxInitialCapacity = 1024
+
+// Option configures an aggregate that is created by NewAggregate, NewStrings, NewBytes, or NewJSON.
+type Option func(*options) error
+
+// options holds the settings of an aggregate that is created with Options. Limits of zero are unlimited.
+type options struct {
+	maxCount, maxSize    int
+	maxDuration, maxIdle time.Duration
+
+	clock      Clock
+	framing    Framing
+	metrics    Metrics
+	split      bool
+	copy       bool
+	contiguous bool
+	wal        *WAL
+
+	spillDir    string
+	spillMemory int
+}
+
+// WithMaxCount sets the maximum number of items stored in the aggregate. A value of zero, the default, does not limit the number of items.
+func WithMaxCount(maxCount int) Option {
+	return func(o *options) error {
+		if maxCount < 0 {
+			return fmt.Errorf("%w: maxCount %d is negative", ErrInvalidOption, maxCount)
+		}
+
+		o.maxCount = maxCount
+		return nil
+	}
+}
+
+// WithMaxSize sets the maximum size of all items stored in the aggregate, including any framing. A value of zero, the default, does not limit the size of the payload.
+func WithMaxSize(maxSize int) Option {
+	return func(o *options) error {
+		if maxSize < 0 {
+			return fmt.Errorf("%w: maxSize %d is negative", ErrInvalidOption, maxSize)
+		}
+
+		o.maxSize = maxSize
+		return nil
+	}
+}
+
+// WithMaxDuration sets the maximum duration that the aggregate will store items, measured from when the first item was added. A value of zero, the default, does not limit the duration.
+func WithMaxDuration(maxDuration time.Duration) Option {
+	return func(o *options) error {
+		if maxDuration < 0 {
+			return fmt.Errorf("%w: maxDuration %v is negative", ErrInvalidOption, maxDuration)
+		}
+
+		o.maxDuration = maxDuration
+		return nil
+	}
+}
+
+// WithMaxIdle sets the maximum duration that the aggregate will wait between items (see SetMaxIdle). A value of zero, the default, disables the idle timeout.
+func WithMaxIdle(maxIdle time.Duration) Option {
+	return func(o *options) error {
+		if maxIdle < 0 {
+			return fmt.Errorf("%w: maxIdle %v is negative", ErrInvalidOption, maxIdle)
+		}
+
+		o.maxIdle = maxIdle
+		return nil
+	}
+}
+
+// WithClock sets the clock that is used to enforce the maximum durations of the aggregate (see SetClock).
+func WithClock(clock Clock) Option {
+	return func(o *options) error {
+		if clock == nil {
+			return fmt.Errorf("%w: clock is nil", ErrInvalidOption)
+		}
+
+		o.clock = clock
+		return nil
+	}
+}
+
+// WithFraming sets the framing that is used to encode the aggregate payload (see SetFraming).
+func WithFraming(framing Framing) Option {
+	return func(o *options) error {
+		o.framing = framing
+		return nil
+	}
+}
+
+// WithMetrics sets the Metrics that receive the events of the aggregate (see SetMetrics).
+func WithMetrics(m Metrics) Option {
+	return func(o *options) error {
+		if m == nil {
+			return fmt.Errorf("%w: metrics is nil", ErrInvalidOption)
+		}
+
+		o.metrics = m
+		return nil
+	}
+}
+
+// WithSplit enables splitting of items that are larger than the maximum size of the aggregate (see Strings.SetSplit). It requires a maximum size and is only supported by Strings and Bytes.
+func WithSplit() Option {
+	return func(o *options) error {
+		o.split = true
+		return nil
+	}
+}
+
+// WithCopy enables copying each item into memory that is owned by the aggregate (see Bytes.SetCopy). It is only supported by Bytes.
+func WithCopy() Option {
+	return func(o *options) error {
+		o.copy = true
+		return nil
+	}
+}
+
+// WithContiguous enables storing the payload in a single contiguous buffer (see Bytes.SetContiguous). It is only supported by Bytes and cannot be combined with WithSpill.
+func WithContiguous() Option {
+	return func(o *options) error {
+		o.contiguous = true
+		return nil
+	}
+}
+
+// WithWAL sets the write-ahead log that every item added to the aggregate is appended to (see Strings.SetWAL). It is only supported by Strings, Bytes, and JSON.
+func WithWAL(wal *WAL) Option {
+	return func(o *options) error {
+		if wal == nil {
+			return fmt.Errorf("%w: WAL is nil", ErrInvalidOption)
+		}
+
+		o.wal = wal
+		return nil
+	}
+}
+
+// WithSpill enables writing items to temporary segment files in dir when the size of the items held in memory would exceed maxMemory (see Strings.SetSpill). It is only supported by Strings and Bytes.
+func WithSpill(dir string, maxMemory int) Option {
+	return func(o *options) error {
+		if maxMemory <= 0 {
+			return fmt.Errorf("%w: spill maxMemory %d is not positive", ErrInvalidOption, maxMemory)
+		}
+
+		o.spillDir, o.spillMemory = dir, maxMemory
+		return nil
+	}
+}
+
+// newOptions applies opts and checks that the resulting settings do not contradict each other.
+func newOptions(opts []Option) (options, error) {
+	var o options
+	for _, opt := range opts {
+		if err := opt(&o); err != nil {
+			return o, err
+		}
+	}
+
+	if o.maxDuration > 0 && o.maxIdle > o.maxDuration {
+		return o, fmt.Errorf("%w: maxIdle %v exceeds maxDuration %v", ErrInvalidOption, o.maxIdle, o.maxDuration)
+	}
+
+	if o.maxSize > 0 && o.framing.Size(1, 0) > o.maxSize {
+		return o, fmt.Errorf("%w: framing does not fit within maxSize %d", ErrInvalidOption, o.maxSize)
+	}
+
+	if o.contiguous && o.spillMemory > 0 {
+		return o, fmt.Errorf("%w: contiguous cannot be combined with spill", ErrInvalidOption)
+	}
+
+	if o.split {
+		if o.maxSize == 0 {
+			return o, fmt.Errorf("%w: split requires maxSize", ErrInvalidOption)
+		}
+
+		if o.maxSize-o.framing.Size(1, 0) <= ChunkHeaderSize {
+			return o, fmt.Errorf("%w: maxSize %d cannot hold a chunk", ErrInvalidOption, o.maxSize)
+		}
+	}
+
+	return o, nil
+}
+
+// unsupported returns an error if any setting that is not in supported is set. Settings are named split, copy, contiguous, WAL, and spill.
+func (o options) unsupported(name string, supported ...string) error {
+	set := map[string]bool{
+		"split":      o.split,
+		"copy":       o.copy,
+		"contiguous": o.contiguous,
+		"WAL":        o.wal != nil,
+		"spill":      o.spillMemory > 0,
+	}
+
+	for _, s := range supported {
+		delete(set, s)
+	}
+
+	for _, setting := range []string{"split", "copy", "contiguous", "WAL", "spill"} {
+		if set[setting] {
+			return fmt.Errorf("%w: %s does not support %s", ErrInvalidOption, name, setting)
+		}
+	}
+
+	return nil
+}
+
+// limits returns the maximum count, size, and duration of the settings, replacing each unlimited value with one that can never be reached.
+func (o options) limits() (int, int, time.Duration) {
+	maxCount, maxSize, maxDuration := o.maxCount, o.maxSize, o.maxDuration
+	if maxCount == 0 {
+		maxCount = math.MaxInt
+	}
+
+	if maxSize == 0 {
+		maxSize = math.MaxInt
+	}
+
+	if maxDuration == 0 {
+		maxDuration = unlimitedDuration
+	}
+
+	return maxCount, maxSize, maxDuration
+}
+
+// configure applies the settings that are shared by all aggregate types. It is called after the aggregate is initialized.
+func configure[T any](a *Aggregate[T], o options) {
+	if o.clock != nil {
+		a.SetClock(o.clock)
+	}
+
+	a.SetMaxIdle(o.maxIdle)
+	a.SetFraming(o.framing)
+	if o.metrics != nil {
+		a.SetMetrics(o.metrics)
+	}
+}
+
+// initialCapacity returns the number of items that is allocated for a payload that holds at most maxCount items.
+func initialCapacity(maxCount int) int {
+	if maxCount < 0 {
+		return 0
+	}
+
+	if maxCount > maxInitialCapacity {
+		return maxInitialCapacity
+	}
+
+	return maxCount
+}
+
+/*
+NewAggregate creates an Aggregate that uses sizer to calculate the size of each item and is configured with opts. Limits that are not set are unlimited; if the options are invalid or contradict each other, then an error wrapping ErrInvalidOption is returned.
+
+Options that depend on the type of the items (WithSplit, WithCopy, WithContiguous, WithWAL, and WithSpill) are not supported; they can be set on the returned Aggregate with SetWAL and SetSpill.
+*/
+func NewAggregate[T any](sizer Sizer[T], opts ...Option) (*Aggregate[T], error) {
+	o, err := newOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := o.unsupported("Aggregate"); err != nil {
+		return nil, err
+	}
+
+	a := &Aggregate[T]{}
+	maxCount, maxSize, maxDuration := o.limits()
+	a.New(maxCount, maxSize, maxDuration, sizer)
+	configure(a, o)
+
+	return a, nil
+}
+
+// NewStrings creates a Strings aggregate that is configured with opts. Limits that are not set are unlimited; if the options are invalid or contradict each other, then an error wrapping ErrInvalidOption is returned. WithCopy and WithContiguous are not supported because strings cannot be modified.
+func NewStrings(opts ...Option) (*Strings, error) {
+	o, err := newOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := o.unsupported("Strings", "split", "WAL", "spill"); err != nil {
+		return nil, err
+	}
+
+	a := &Strings{}
+	maxCount, maxSize, maxDuration := o.limits()
+	a.New(maxCount, maxSize, maxDuration)
+	configure(&a.Aggregate, o)
+
+	a.SetSplit(o.split)
+	if o.wal != nil {
+		a.SetWAL(o.wal)
+	}
+
+	if o.spillMemory > 0 {
+		a.SetSpill(o.spillDir, o.spillMemory)
+	}
+
+	return a, nil
+}
+
+// NewBytes creates a Bytes aggregate that is configured with opts. Limits that are not set are unlimited; if the options are invalid or contradict each other, then an error wrapping ErrInvalidOption is returned.
+func NewBytes(opts ...Option) (*Bytes, error) {
+	o, err := newOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &Bytes{}
+	maxCount, maxSize, maxDuration := o.limits()
+	a.New(maxCount, maxSize, maxDuration)
+	configure(&a.Aggregate, o)
+
+	a.SetSplit(o.split)
+	a.SetCopy(o.copy)
+	if o.contiguous {
+		a.SetContiguous(true)
+	}
+	if o.wal != nil {
+		a.SetWAL(o.wal)
+	}
+
+	if o.spillMemory > 0 {
+		a.SetSpill(o.spillDir, o.spillMemory)
+	}
+
+	return a, nil
+}
+
+// NewJSON creates a JSON aggregate that is configured with opts. Limits that are not set are unlimited; if the options are invalid or contradict each other, then an error wrapping ErrInvalidOption is returned. WithSplit, WithCopy, WithContiguous, and WithSpill are not supported.
+func NewJSON(opts ...Option) (*JSON, error) {
+	o, err := newOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := o.unsupported("JSON", "WAL"); err != nil {
+		return nil, err
+	}
+
+	a := &JSON{}
+	maxCount, maxSize, maxDuration := o.limits()
+	a.New(maxCount, maxSize, maxDuration)
+	configure(&a.Aggregate, o)
+
+	if o.wal != nil {
+		a.SetWAL(o.wal)
+	}
+
+	return a, nil
+}
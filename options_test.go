@@ -0,0 +1,192 @@
+package aggregate
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jshlbrd/go-aggregate/aggregatetest"
+)
+
+func TestNewStringsOptions(t *testing.T) {
+	var tests = []struct {
+		name    string
+		opts    []Option
+		invalid bool
+	}{
+		{
+			"defaults",
+			nil,
+			false,
+		},
+		{
+			"limits",
+			[]Option{WithMaxCount(10), WithMaxSize(100), WithMaxDuration(time.Second), WithMaxIdle(time.Millisecond)},
+			false,
+		},
+		{
+			"negative count",
+			[]Option{WithMaxCount(-1)},
+			true,
+		},
+		{
+			"negative size",
+			[]Option{WithMaxSize(-1)},
+			true,
+		},
+		{
+			"negative duration",
+			[]Option{WithMaxDuration(-time.Second)},
+			true,
+		},
+		{
+			"idle exceeds duration",
+			[]Option{WithMaxDuration(time.Millisecond), WithMaxIdle(time.Second)},
+			true,
+		},
+		{
+			"idle without duration",
+			[]Option{WithMaxIdle(time.Second)},
+			false,
+		},
+		{
+			"framing exceeds size",
+			[]Option{WithMaxSize(1), WithFraming(JSONArrayFraming)},
+			true,
+		},
+		{
+			"split without size",
+			[]Option{WithSplit()},
+			true,
+		},
+		{
+			"split smaller than chunk header",
+			[]Option{WithSplit(), WithMaxSize(ChunkHeaderSize)},
+			true,
+		},
+		{
+			"spill without memory",
+			[]Option{WithSpill("", 0)},
+			true,
+		},
+		{
+			"nil clock",
+			[]Option{WithClock(nil)},
+			true,
+		},
+	}
+
+	for _, test := range tests {
+		_, err := NewStrings(test.opts...)
+		if test.invalid != (err != nil) {
+			t.Logf("%s: expected invalid %v, got %v", test.name, test.invalid, err)
+			t.Fail()
+		}
+
+		if err != nil && !errors.Is(err, ErrInvalidOption) {
+			t.Logf("%s: expected %v, got %v", test.name, ErrInvalidOption, err)
+			t.Fail()
+		}
+	}
+}
+
+func TestNewStringsUnlimited(t *testing.T) {
+	clock := aggregatetest.NewClock(time.Unix(0, 0))
+	agg, err := NewStrings(WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 10000; i++ {
+		if err := agg.Add(strings.Repeat("a", 100)); err != nil {
+			t.Fatalf("expected nil, got %v", err)
+		}
+		clock.Advance(time.Hour)
+	}
+
+	if agg.Count() != 10000 {
+		t.Logf("expected %v, got %v", 10000, agg.Count())
+		t.Fail()
+	}
+
+	if !agg.Deadline().IsZero() {
+		t.Logf("expected zero deadline, got %v", agg.Deadline())
+		t.Fail()
+	}
+}
+
+func TestNewStringsLimits(t *testing.T) {
+	clock := aggregatetest.NewClock(time.Unix(0, 0))
+	agg, err := NewStrings(WithMaxCount(2), WithMaxSize(8), WithMaxIdle(time.Second), WithClock(clock), WithFraming(NDJSONFraming))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		data     string
+		advance  time.Duration
+		expected error
+	}{
+		{"foo", 0, nil},
+		{"barbaz", 0, ErrSizeExceeded},
+		{"bar", 2 * time.Second, ErrIdle},
+	}
+
+	for _, test := range tests {
+		clock.Advance(test.advance)
+		if err := agg.Add(test.data); err != test.expected {
+			t.Logf("expected %v, got %v", test.expected, err)
+			t.Fail()
+		}
+	}
+
+	if agg.Deadline() != time.Unix(1, 0) {
+		t.Logf("expected %v, got %v", time.Unix(1, 0), agg.Deadline())
+		t.Fail()
+	}
+}
+
+func TestNewJSONUnsupported(t *testing.T) {
+	var tests = []struct {
+		name string
+		opts []Option
+	}{
+		{
+			"split",
+			[]Option{WithMaxSize(100), WithSplit()},
+		},
+		{
+			"spill",
+			[]Option{WithSpill("", 100)},
+		},
+	}
+
+	for _, test := range tests {
+		if _, err := NewJSON(test.opts...); !errors.Is(err, ErrInvalidOption) {
+			t.Logf("%s: expected %v, got %v", test.name, ErrInvalidOption, err)
+			t.Fail()
+		}
+	}
+}
+
+func TestNewAggregate(t *testing.T) {
+	agg, err := NewAggregate(recordSize, WithMaxCount(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, data := range []record{{1, "foo"}, {2, "bar"}, {3, "baz"}} {
+		agg.Add(data)
+	}
+
+	if agg.Count() != 2 {
+		t.Logf("expected %v, got %v", 2, agg.Count())
+		t.Fail()
+	}
+
+	if _, err := NewAggregate(recordSize, WithWAL(&WAL{})); !errors.Is(err, ErrInvalidOption) {
+		t.Logf("expected %v, got %v", ErrInvalidOption, err)
+		t.Fail()
+	}
+}
@@ -0,0 +1,72 @@
+package aggregate
+
+import (
+	"context"
+	"time"
+)
+
+/*
+Pipeline adds every item received from in to agg and sends each payload to the returned channel. Payloads are sent when the aggregate is full or has expired, and any remaining payload is sent when in is closed.
+
+The returned channel is closed when in is closed or ctx is cancelled; if ctx is cancelled, then any remaining payload is discarded. Items that can never be added to the aggregate are discarded. The aggregate should not be used directly while it is used by the pipeline.
+*/
+func Pipeline[T any](ctx context.Context, in <-chan T, agg Aggregator[T]) <-chan []T {
+	out := make(chan []T)
+
+	go func() {
+		defer close(out)
+
+		f := AutoFlusher[T]{}
+		f.New(agg, func(batch []T) {
+			// select chooses randomly when both cases are ready, so a cancelled ctx is checked first to always discard the payload.
+			if ctx.Err() != nil {
+				return
+			}
+
+			select {
+			case out <- append([]T(nil), batch...):
+			case <-ctx.Done():
+			}
+		})
+		defer f.Close()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case data, ok := <-in:
+				if !ok {
+					return
+				}
+
+				_ = f.Add(data)
+			}
+		}
+	}()
+
+	return out
+}
+
+// StringsPipeline creates a Strings aggregate with the provided settings and returns a channel of payloads. See Pipeline.
+func StringsPipeline(ctx context.Context, in <-chan string, maxCount, maxSize int, maxDuration time.Duration) <-chan []string {
+	agg := Strings{}
+	agg.New(maxCount, maxSize, maxDuration)
+
+	return Pipeline[string](ctx, in, &agg)
+}
+
+// BytesPipeline creates a Bytes aggregate with the provided settings and returns a channel of payloads. See Pipeline.
+func BytesPipeline(ctx context.Context, in <-chan []byte, maxCount, maxSize int, maxDuration time.Duration) <-chan [][]byte {
+	agg := Bytes{}
+	agg.New(maxCount, maxSize, maxDuration)
+
+	return Pipeline[[]byte](ctx, in, &agg)
+}
+
+// JSONPipeline creates a JSON aggregate with the provided settings and returns a channel of payloads. See Pipeline.
+func JSONPipeline(ctx context.Context, in <-chan interface{}, maxCount, maxSize int, maxDuration time.Duration) <-chan []interface{} {
+	agg := JSON{}
+	agg.New(maxCount, maxSize, maxDuration)
+
+	return Pipeline[interface{}](ctx, in, &agg)
+}
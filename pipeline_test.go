@@ -0,0 +1,98 @@
+package aggregate
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestStringsPipeline(t *testing.T) {
+	var tests = []struct {
+		data     []string
+		expected [][]string
+	}{
+		{
+			[]string{
+				"foo",
+				"bar",
+				"baz",
+			},
+			[][]string{
+				{"foo", "bar"},
+				{"baz"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		in := make(chan string)
+		out := StringsPipeline(context.Background(), in, 2, 100, time.Minute)
+
+		go func() {
+			for _, data := range test.data {
+				in <- data
+			}
+			close(in)
+		}()
+
+		var batches [][]string
+		for batch := range out {
+			batches = append(batches, batch)
+		}
+
+		if len(batches) != len(test.expected) {
+			t.Fatalf("expected %v, got %v", test.expected, batches)
+		}
+
+		for i, batch := range batches {
+			for j, item := range batch {
+				if item != test.expected[i][j] {
+					t.Logf("expected %v, got %v", test.expected[i][j], item)
+					t.Fail()
+				}
+			}
+		}
+	}
+}
+
+// TestPipelineTimeout tests that an expired payload is sent while the input channel is still open.
+func TestPipelineTimeout(t *testing.T) {
+	in := make(chan []byte)
+	out := BytesPipeline(context.Background(), in, 100, 100, 5*time.Millisecond)
+	defer close(in)
+
+	in <- []byte("foo")
+
+	select {
+	case batch := <-out:
+		if len(batch) != 1 || string(batch[0]) != "foo" {
+			t.Logf("expected %v, got %v", "foo", batch)
+			t.Fail()
+		}
+	case <-time.After(time.Second):
+		t.Log("expected payload to be sent")
+		t.Fail()
+	}
+}
+
+// TestPipelineCancel tests that the remaining payload is discarded when ctx is cancelled, even if the output channel is being received from.
+func TestPipelineCancel(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		ctx, cancel := context.WithCancel(context.Background())
+
+		in := make(chan interface{})
+		out := JSONPipeline(ctx, in, 100, 100, time.Minute)
+
+		in <- map[string]string{"foo": "bar"}
+		cancel()
+
+		select {
+		case batch, ok := <-out:
+			if ok {
+				t.Fatalf("expected payload to be discarded, got %v", batch)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("expected output channel to be closed")
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package aggregate
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// PrometheusMetrics is a Metrics that exports the events of aggregates in the Prometheus text exposition format. It is safe for concurrent use, so it can be shared by multiple aggregates.
+type PrometheusMetrics struct {
+	recorder
+	namespace string
+}
+
+/*
+New initializes a new PrometheusMetrics with these settings:
+	namespace:
+		the prefix of the name of each metric; if the namespace is empty, then "aggregate" is used.
+
+The metrics are written by WriteTo and served by ServeHTTP, so a PrometheusMetrics can be registered directly as the handler of a scrape endpoint.
+*/
+func (m *PrometheusMetrics) New(namespace string) {
+	m.init()
+
+	m.namespace = namespace
+	if m.namespace == "" {
+		m.namespace = "aggregate"
+	}
+}
+
+// WriteTo writes the metrics to w in the Prometheus text exposition format. It implements io.WriterTo.
+func (m *PrometheusMetrics) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cw := &countWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	ns := m.namespace
+
+	writeHeader(bw, ns+"_items_added_total", "counter", "Number of items added to aggregates.")
+	fmt.Fprintf(bw, "%s_items_added_total %d\n", ns, m.added)
+
+	writeHeader(bw, ns+"_added_size_total", "counter", "Total size of items added to aggregates.")
+	fmt.Fprintf(bw, "%s_added_size_total %d\n", ns, m.addedSize)
+
+	writeHeader(bw, ns+"_items_rejected_total", "counter", "Number of add attempts that failed, by reason.")
+	for _, reason := range m.reasons() {
+		fmt.Fprintf(bw, "%s_items_rejected_total{reason=%q} %d\n", ns, reason, m.rejected[reason])
+	}
+
+	writeHeader(bw, ns+"_flushes_total", "counter", "Number of payloads flushed, by trigger.")
+	for _, t := range triggers {
+		fmt.Fprintf(bw, "%s_flushes_total{trigger=%q} %d\n", ns, t.String(), m.flushes[t])
+	}
+
+	writeHistogram(bw, ns+"_batch_items", "Number of items in each flushed payload.", &m.batchCount)
+	writeHistogram(bw, ns+"_batch_size", "Size of each flushed payload.", &m.batchSize)
+	writeHistogram(bw, ns+"_batch_open_seconds", "Duration that each flushed payload was open.", &m.batchOpen)
+
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// ServeHTTP writes the metrics to the response in the Prometheus text exposition format. It implements http.Handler.
+func (m *PrometheusMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = m.WriteTo(w)
+}
+
+func writeHeader(w io.Writer, name, typ, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+func writeHistogram(w io.Writer, name, help string, h *histogram) {
+	writeHeader(w, name, "histogram", help)
+	for i, n := range h.cumulative() {
+		fmt.Fprintf(w, "%s_bucket{le=%q} %d\n", name, formatFloat(h.bounds[i]), n)
+	}
+
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", name, h.count)
+	fmt.Fprintf(w, "%s_sum %s\n", name, formatFloat(h.sum))
+	fmt.Fprintf(w, "%s_count %d\n", name, h.count)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// countWriter counts the bytes written to w.
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countWriter) Write(b []byte) (int, error) {
+	n, err := c.w.Write(b)
+	c.n += int64(n)
+
+	return n, err
+}
@@ -0,0 +1,64 @@
+package aggregate
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jshlbrd/go-aggregate/aggregatetest"
+)
+
+func TestPrometheusMetrics(t *testing.T) {
+	clock := aggregatetest.NewClock(time.Unix(0, 0))
+	m := PrometheusMetrics{}
+	m.New("")
+
+	agg := Bytes{}
+	agg.SetClock(clock)
+	agg.New(10, 5, time.Minute)
+	agg.SetMetrics(&m)
+
+	for _, data := range []string{"foo", "bar", "bazqux"} {
+		clock.Advance(time.Second)
+		if err := agg.Add([]byte(data)); err == ErrSizeExceeded {
+			agg.Reset()
+			agg.Add([]byte(data))
+		}
+	}
+	agg.Reset()
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+
+	var tests = []string{
+		"# TYPE aggregate_items_added_total counter",
+		"aggregate_items_added_total 2",
+		"aggregate_added_size_total 6",
+		`aggregate_items_rejected_total{reason="ErrItemTooLarge"} 1`,
+		`aggregate_items_rejected_total{reason="ErrSizeExceeded"} 1`,
+		`aggregate_flushes_total{trigger="size"} 1`,
+		`aggregate_flushes_total{trigger="manual"} 1`,
+		`aggregate_flushes_total{trigger="age"} 0`,
+		"# TYPE aggregate_batch_items histogram",
+		`aggregate_batch_items_bucket{le="1"} 2`,
+		`aggregate_batch_items_bucket{le="+Inf"} 2`,
+		"aggregate_batch_items_count 2",
+		"aggregate_batch_size_sum 6",
+		`aggregate_batch_open_seconds_bucket{le="1"} 2`,
+		"aggregate_batch_open_seconds_sum 2",
+	}
+
+	for _, test := range tests {
+		if !strings.Contains(body, test+"\n") {
+			t.Logf("expected %q in:\n%s", test, body)
+			t.Fail()
+		}
+	}
+
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Logf("expected text/plain, got %v", ct)
+		t.Fail()
+	}
+}
@@ -0,0 +1,353 @@
+package aggregate
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// FileName is the data that is available to the name template of a RotatingFile.
+type FileName struct {
+	// Time is the time when the file was opened.
+	Time time.Time
+	// Sequence is the number of the file, starting from one when the RotatingFile is initialized.
+	Sequence uint64
+}
+
+/*
+RotatingFile is an io.WriteCloser that writes to files in a local directory and rotates them when they reach a size or age limit. Each call to Write is written to a single file, so when it is used as the io.Writer of a Sink, every batch is written to one file and is never split across files.
+
+Files are written with a temporary name that starts with a dot and ends with ".tmp", and they are only renamed to their final name once they are complete, so a process that picks up completed files (such as an uploader) never reads a partially written file. Existing files are never replaced: if a file with the same name already exists, then the next sequence number is used instead. It is safe for concurrent use.
+*/
+type RotatingFile struct {
+	mu sync.Mutex
+
+	dir     string
+	name    *template.Template
+	maxSize int
+	maxAge  time.Duration
+
+	gzip    bool
+	clock   Clock
+	onError func(error)
+	// link links a completed file to its final name; it is replaced in tests.
+	link func(oldname, newname string) error
+
+	// f is the file that is being written, which is nil if no file is open. w writes to f, through a gzip.Writer if gzip is enabled.
+	f    *os.File
+	w    io.Writer
+	gz   *gzip.Writer
+	path string
+	// size is the number of bytes written to the file, before compression, and opened is the time when it was opened.
+	size   int
+	opened time.Time
+	stop   func() bool
+
+	sequence uint64
+}
+
+/*
+New initializes a new RotatingFile with these settings:
+	dir:
+		the directory that files are written to; it is created if it does not exist.
+	name:
+		the text/template that is used to name each file, which receives a FileName; for example, "events-{{.Time.Format \"20060102T150405\"}}-{{.Sequence}}.ndjson". The name must include the sequence number so that files never have the same name. If gzip is enabled, then the name should end with ".gz".
+	maxSize:
+		the size of the data written to a file, before compression, at which the file is completed; a value of zero disables the limit.
+	maxAge:
+		the duration since a file was opened at which the file is completed, even if no more data is written; a value of zero disables the limit.
+
+If both limits are disabled, then every Write is written to a new file. If the name template cannot be parsed or the directory cannot be created, then an error is returned; if the name template can produce the same name for two files, then an error wrapping ErrInvalidOption is returned.
+*/
+func (r *RotatingFile) New(dir, name string, maxSize int, maxAge time.Duration) error {
+	tmpl, err := template.New("name").Parse(name)
+	if err != nil {
+		return err
+	}
+
+	// files that are opened at the same time only differ by their sequence number.
+	var first, second bytes.Buffer
+	now := time.Now()
+	if err := tmpl.Execute(&first, FileName{Time: now, Sequence: 1}); err != nil {
+		return err
+	}
+
+	if err := tmpl.Execute(&second, FileName{Time: now, Sequence: 2}); err != nil {
+		return err
+	}
+
+	if first.String() == second.String() {
+		return fmt.Errorf("%w: name template %q does not include the sequence number", ErrInvalidOption, name)
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.dir = dir
+	r.name = tmpl
+	r.maxSize = maxSize
+	r.maxAge = maxAge
+	r.sequence = 0
+	if r.clock == nil {
+		r.clock = systemClock{}
+	}
+	r.link = os.Link
+
+	return nil
+}
+
+// SetGzip enables or disables compressing files with gzip. It applies to files that are opened after it is called.
+func (r *RotatingFile) SetGzip(enabled bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.gzip = enabled
+}
+
+// SetClock sets the clock that is used to name files and enforce their maximum age. By default, the system clock is used.
+func (r *RotatingFile) SetClock(clock Clock) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.clock = clock
+}
+
+// SetErrorHandler sets the function that receives the errors that occur when a file is completed because it reached its maximum age, which happens outside of any call to Write, and the errors that occur when the temporary name of a completed file cannot be removed.
+func (r *RotatingFile) SetErrorHandler(onError func(error)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.onError = onError
+}
+
+/*
+Write writes b to the current file, opening a new file if none is open or if the current file has reached its maximum age. The file is completed after the write if it has reached its maximum size or if no limits are set. It implements io.Writer.
+
+If b cannot be written or the file cannot be completed, then zero and the error are returned, because b has not been written to a completed file and should be written again. The current file is abandoned: it is closed without being renamed, so it keeps its temporary name and is never completed, and the next Write opens a new file. Abandoned files are left in the directory with their temporary names, so that their data can be recovered or removed.
+*/
+func (r *RotatingFile) Write(b []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.f != nil && r.maxAge > 0 && r.clock.Now().Sub(r.opened) >= r.maxAge {
+		if err := r.complete(); err != nil {
+			return 0, err
+		}
+	}
+
+	if r.f == nil {
+		if err := r.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := r.w.Write(b)
+	r.size += n
+	if err != nil {
+		r.abandon()
+		return 0, err
+	}
+
+	if (r.maxSize == 0 && r.maxAge == 0) || (r.maxSize > 0 && r.size >= r.maxSize) {
+		if err := r.complete(); err != nil {
+			return 0, err
+		}
+	}
+
+	return n, nil
+}
+
+// Rotate completes the current file, if one is open. The next Write opens a new file.
+func (r *RotatingFile) Rotate() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.complete()
+}
+
+// Close completes the current file, if one is open. It implements io.Closer.
+func (r *RotatingFile) Close() error {
+	return r.Rotate()
+}
+
+// open opens a new file with a temporary name. Names that are already used by a completed or temporary file are skipped. The caller must hold the lock.
+func (r *RotatingFile) open() error {
+	now := r.clock.Now()
+
+	var f *os.File
+	var path string
+	for {
+		var err error
+		if path, err = r.fileName(now, r.sequence+1); err != nil {
+			return err
+		}
+
+		if _, err = os.Lstat(path); err == nil {
+			r.sequence++
+			continue
+		}
+
+		f, err = os.OpenFile(tempPath(path), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if errors.Is(err, fs.ErrExist) {
+			r.sequence++
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		break
+	}
+
+	r.sequence++
+	r.f, r.w, r.gz = f, f, nil
+	if r.gzip {
+		r.gz = gzip.NewWriter(f)
+		r.w = r.gz
+	}
+
+	r.path = path
+	r.size = 0
+	r.opened = now
+
+	if r.maxAge > 0 {
+		f := r.f
+		r.stop = r.clock.AfterFunc(r.maxAge, func() { r.expire(f) })
+	}
+
+	return nil
+}
+
+// fileName returns the path of the file with a sequence number that is opened at t.
+func (r *RotatingFile) fileName(t time.Time, sequence uint64) (string, error) {
+	var name bytes.Buffer
+	if err := r.name.Execute(&name, FileName{Time: t, Sequence: sequence}); err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(r.dir, name.String())
+	if filepath.Dir(path) != filepath.Clean(r.dir) {
+		return "", &os.PathError{Op: "open", Path: name.String(), Err: os.ErrInvalid}
+	}
+
+	return path, nil
+}
+
+// expire completes f if it is still the current file.
+func (r *RotatingFile) expire(f *os.File) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.f != f {
+		return
+	}
+
+	if err := r.complete(); err != nil && r.onError != nil {
+		r.onError(err)
+	}
+}
+
+// complete flushes, syncs, and closes the current file and renames it to its final name. If the file cannot be completed, then it keeps its temporary name. The caller must hold the lock.
+func (r *RotatingFile) complete() error {
+	if r.f == nil {
+		return nil
+	}
+
+	f, gz, path := r.f, r.gz, r.path
+	r.detach()
+
+	var err error
+	if gz != nil {
+		err = gz.Close()
+	}
+
+	if err == nil {
+		err = f.Sync()
+	}
+
+	// the file is only renamed once it has been closed, so a partially written file never has its final name.
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return r.rename(tempPath(path), path)
+}
+
+/*
+rename renames a completed file from its temporary path to path without replacing an existing file. If another file was given the name since the file was opened, then the name with the next sequence number is used.
+
+The file is linked to its final name, which fails if the name exists, and then its temporary name is removed. If the file cannot be linked for another reason, such as a filesystem that does not support hard links, then it is renamed if no file has its final name; the check and the rename are not atomic, so files in such a directory should only be written by one RotatingFile. The caller must hold the lock.
+*/
+func (r *RotatingFile) rename(tmp, path string) error {
+	for {
+		err := r.link(tmp, path)
+		if err == nil {
+			// the file is already published, so a temporary name that cannot be removed is reported without failing the file.
+			if err := os.Remove(tmp); err != nil && r.onError != nil {
+				r.onError(err)
+			}
+
+			break
+		}
+
+		if !errors.Is(err, fs.ErrExist) {
+			if _, serr := os.Lstat(path); errors.Is(serr, fs.ErrNotExist) {
+				if err := os.Rename(tmp, path); err != nil {
+					return err
+				}
+
+				break
+			} else if serr != nil {
+				return err
+			}
+		}
+
+		r.sequence++
+		if path, err = r.fileName(r.opened, r.sequence); err != nil {
+			return err
+		}
+	}
+
+	// the rename is only durable once the directory is synced.
+	return syncDir(r.dir)
+}
+
+// abandon closes the current file without renaming it. The caller must hold the lock.
+func (r *RotatingFile) abandon() {
+	f := r.f
+	r.detach()
+
+	f.Close()
+}
+
+// detach stops the age timer of the current file and removes it from the RotatingFile. The caller must hold the lock.
+func (r *RotatingFile) detach() {
+	if r.stop != nil {
+		r.stop()
+		r.stop = nil
+	}
+
+	r.f, r.w, r.gz = nil, nil, nil
+}
+
+// tempPath returns the temporary path of a file, which is hidden and ends with ".tmp".
+func tempPath(path string) string {
+	return filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+}
@@ -0,0 +1,285 @@
+package aggregate
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/jshlbrd/go-aggregate/aggregatetest"
+)
+
+// readDir returns the names of the files in dir, sorted by name.
+func readDir(t *testing.T, dir string) []string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func TestRotatingFile(t *testing.T) {
+	var tests = []struct {
+		name     string
+		maxSize  int
+		data     []string
+		expected map[string]string
+	}{
+		{
+			"file per write",
+			0,
+			[]string{"foo\n", "bar\n"},
+			map[string]string{"1.log": "foo\n", "2.log": "bar\n"},
+		},
+		{
+			"size",
+			8,
+			[]string{"foo\n", "bar\n", "baz\n"},
+			map[string]string{"1.log": "foo\nbar\n", "2.log": "baz\n"},
+		},
+	}
+
+	for _, test := range tests {
+		dir := t.TempDir()
+		r := RotatingFile{}
+		if err := r.New(dir, "{{.Sequence}}.log", test.maxSize, 0); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, data := range test.data {
+			if _, err := r.Write([]byte(data)); err != nil {
+				t.Fatalf("%s: unexpected error: %v", test.name, err)
+			}
+		}
+
+		if err := r.Close(); err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.name, err)
+		}
+
+		names := readDir(t, dir)
+		if len(names) != len(test.expected) {
+			t.Fatalf("%s: expected %v files, got %v", test.name, len(test.expected), names)
+		}
+
+		for name, expected := range test.expected {
+			b, err := os.ReadFile(filepath.Join(dir, name))
+			if err != nil || string(b) != expected {
+				t.Logf("%s: expected %q in %s, got %q (%v)", test.name, expected, name, b, err)
+				t.Fail()
+			}
+		}
+	}
+}
+
+func TestRotatingFileTemporary(t *testing.T) {
+	dir := t.TempDir()
+	clock := aggregatetest.NewClock(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC))
+
+	r := RotatingFile{}
+	r.SetClock(clock)
+	if err := r.New(dir, `events-{{.Time.Format "20060102T150405"}}-{{.Sequence}}.log`, 100, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	r.Write([]byte("foo\n"))
+
+	// the file keeps its temporary name until it is complete.
+	if names := readDir(t, dir); len(names) != 1 || names[0] != ".events-20240102T030405-1.log.tmp" {
+		t.Logf("expected a temporary file, got %v", names)
+		t.Fail()
+	}
+
+	r.Rotate()
+	if names := readDir(t, dir); len(names) != 1 || names[0] != "events-20240102T030405-1.log" {
+		t.Logf("expected a completed file, got %v", names)
+		t.Fail()
+	}
+}
+
+func TestRotatingFileExisting(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "1.log"), []byte("old\n"), 0o644)
+
+	r := RotatingFile{}
+	if err := r.New(dir, "{{.Sequence}}.log", 100, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// names of existing files are skipped when a file is opened.
+	r.Write([]byte("foo\n"))
+	if names := readDir(t, dir); len(names) != 2 || names[0] != ".2.log.tmp" {
+		t.Logf("expected a temporary file, got %v", names)
+		t.Fail()
+	}
+
+	// a file is never completed over a file that was created after it was opened, and it is not left with its temporary name.
+	os.WriteFile(filepath.Join(dir, "2.log"), []byte("new\n"), 0o644)
+	if err := r.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := map[string]string{"1.log": "old\n", "2.log": "new\n", "3.log": "foo\n"}
+	if names := readDir(t, dir); len(names) != len(expected) {
+		t.Fatalf("expected %v files, got %v", len(expected), names)
+	}
+
+	for name, data := range expected {
+		if b, err := os.ReadFile(filepath.Join(dir, name)); err != nil || string(b) != data {
+			t.Logf("expected %q in %s, got %q (%v)", data, name, b, err)
+			t.Fail()
+		}
+	}
+}
+
+// TestRotatingFileRename tests that completed files are renamed without replacing existing files when hard links are not supported.
+func TestRotatingFileRename(t *testing.T) {
+	dir := t.TempDir()
+
+	r := RotatingFile{}
+	if err := r.New(dir, "{{.Sequence}}.log", 100, 0); err != nil {
+		t.Fatal(err)
+	}
+	r.link = func(oldname, newname string) error {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: errors.New("operation not supported")}
+	}
+
+	r.Write([]byte("foo\n"))
+	os.WriteFile(filepath.Join(dir, "1.log"), []byte("old\n"), 0o644)
+	if err := r.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := map[string]string{"1.log": "old\n", "2.log": "foo\n"}
+	if names := readDir(t, dir); len(names) != len(expected) {
+		t.Fatalf("expected %v files, got %v", len(expected), names)
+	}
+
+	for name, data := range expected {
+		if b, err := os.ReadFile(filepath.Join(dir, name)); err != nil || string(b) != data {
+			t.Logf("expected %q in %s, got %q (%v)", data, name, b, err)
+			t.Fail()
+		}
+	}
+
+	// a file that cannot be completed has not been written, so Write reports that no bytes were written.
+	r.link = func(oldname, newname string) error {
+		os.Remove(oldname)
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: errors.New("operation not supported")}
+	}
+
+	// the file reaches its maximum size, so it is completed by Write.
+	if n, err := r.Write(make([]byte, 100)); n != 0 || err == nil {
+		t.Logf("expected no bytes to be written, got %v (%v)", n, err)
+		t.Fail()
+	}
+}
+
+func TestRotatingFileAge(t *testing.T) {
+	dir := t.TempDir()
+	clock := aggregatetest.NewClock(time.Unix(0, 0))
+
+	r := RotatingFile{}
+	r.SetClock(clock)
+	if err := r.New(dir, "{{.Sequence}}.log", 0, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	// waitFor waits until the file with name has been completed.
+	waitFor := func(name string) {
+		for {
+			if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	// writes are appended to the file until it reaches its maximum age, even if no more data is written.
+	r.Write([]byte("foo\n"))
+	clock.Advance(30 * time.Second)
+	r.Write([]byte("bar\n"))
+	clock.Advance(30 * time.Second)
+	waitFor("1.log")
+
+	r.Write([]byte("baz\n"))
+	clock.Advance(time.Minute)
+	waitFor("2.log")
+
+	b1, _ := os.ReadFile(filepath.Join(dir, "1.log"))
+	b2, _ := os.ReadFile(filepath.Join(dir, "2.log"))
+	if string(b1) != "foo\nbar\n" || string(b2) != "baz\n" {
+		t.Logf("expected %q and %q, got %q and %q", "foo\nbar\n", "baz\n", b1, b2)
+		t.Fail()
+	}
+
+	if names := readDir(t, dir); len(names) != 2 {
+		t.Logf("expected only completed files, got %v", names)
+		t.Fail()
+	}
+}
+
+func TestRotatingFileGzip(t *testing.T) {
+	dir := t.TempDir()
+
+	r := RotatingFile{}
+	if err := r.New(dir, "{{.Sequence}}.ndjson.gz", 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	r.SetGzip(true)
+
+	s := StringsSink(&r, NDJSONFraming, NoLength)
+	if err := s.Write([]string{"foo", "bar"}); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(filepath.Join(dir, "1.ndjson.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := io.ReadAll(gz)
+	if err != nil || string(b) != "foo\nbar\n" {
+		t.Logf("expected %q, got %q (%v)", "foo\nbar\n", b, err)
+		t.Fail()
+	}
+}
+
+func TestRotatingFileInvalid(t *testing.T) {
+	r := RotatingFile{}
+	if err := r.New(t.TempDir(), "{{.Sequence", 0, 0); err == nil {
+		t.Logf("expected an error for an invalid template")
+		t.Fail()
+	}
+
+	// a template without the sequence number produces the same name for files that are opened at the same time.
+	if err := r.New(t.TempDir(), `events-{{.Time.Format "20060102"}}.log`, 0, 0); !errors.Is(err, ErrInvalidOption) {
+		t.Logf("expected %v, got %v", ErrInvalidOption, err)
+		t.Fail()
+	}
+
+	if err := r.New(t.TempDir(), "../{{.Sequence}}.log", 0, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := r.Write([]byte("foo")); err == nil {
+		t.Logf("expected an error for a file outside of the directory")
+		t.Fail()
+	}
+}
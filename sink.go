@@ -0,0 +1,181 @@
+package aggregate
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+)
+
+// LengthPrefix is the encoding of the length that is written before each item of a batch.
+type LengthPrefix int
+
+const (
+	// NoLength does not write the length of items.
+	NoLength LengthPrefix = iota
+	// VarintLength writes the length of each item as an unsigned varint (see encoding/binary).
+	VarintLength
+	// Uint32Length writes the length of each item as a big-endian uint32.
+	Uint32Length
+)
+
+// batchEncoder encodes batches with a framing and a length prefix.
+type batchEncoder[T any] struct {
+	framing Framing
+	length  LengthPrefix
+	// marshal appends the encoded form of an item to dst.
+	marshal func(dst []byte, item T) ([]byte, error)
+}
+
+// encode appends the encoded batch to dst. If an item is too large for the length prefix, then ErrItemTooLarge is returned.
+func (e *batchEncoder[T]) encode(dst []byte, batch []T) ([]byte, error) {
+	dst = append(dst, e.framing.Prefix...)
+	for i, item := range batch {
+		if i > 0 {
+			dst = append(dst, e.framing.Delimiter...)
+		}
+
+		start := len(dst)
+
+		var err error
+		if dst, err = e.marshal(dst, item); err != nil {
+			return dst, err
+		}
+
+		if dst, err = e.prefixLength(dst, start); err != nil {
+			return dst, err
+		}
+
+		dst = append(dst, e.framing.Terminator...)
+	}
+
+	return append(dst, e.framing.Suffix...), nil
+}
+
+// prefixLength inserts the length prefix of the item that starts at dst[start:] before the item.
+func (e *batchEncoder[T]) prefixLength(dst []byte, start int) ([]byte, error) {
+	n := len(dst) - start
+
+	var header [binary.MaxVarintLen64]byte
+	var h []byte
+	switch e.length {
+	case VarintLength:
+		h = header[:binary.PutUvarint(header[:], uint64(n))]
+	case Uint32Length:
+		if uint64(n) > math.MaxUint32 {
+			return dst, ErrItemTooLarge
+		}
+
+		binary.BigEndian.PutUint32(header[:4], uint32(n))
+		h = header[:4]
+	default:
+		return dst, nil
+	}
+
+	// the item is moved after the prefix within dst so that it does not need to be marshaled into a separate buffer.
+	dst = append(dst, h...)
+	copy(dst[start+len(h):], dst[start:start+n])
+	copy(dst[start:], h)
+
+	return dst, nil
+}
+
+// Sink writes each batch that it receives to an io.Writer. Sinks are not safe for concurrent use; when used as the flush handler of an AutoFlusher, batches are already received one at a time.
+type Sink[T any] struct {
+	w       io.Writer
+	enc     batchEncoder[T]
+	buf     []byte
+	onError func(error)
+}
+
+/*
+New initializes a new Sink with these settings:
+	w:
+		the io.Writer that each batch is written to.
+	framing:
+		the framing that is used to join the items of each batch; for example, NDJSONFraming writes newline delimited items and JSONArrayFraming writes each batch as a JSON array.
+	length:
+		the length prefix that is written before each item; for example, VarintLength with an empty framing writes length-prefixed items.
+	marshal:
+		the function that appends the encoded form of an item to a buffer.
+
+StringsSink, BytesSink, and JSONSink create Sinks for the items of Strings, Bytes, and JSON aggregates.
+*/
+func (s *Sink[T]) New(w io.Writer, framing Framing, length LengthPrefix, marshal func(dst []byte, item T) ([]byte, error)) {
+	s.w = w
+	s.enc = batchEncoder[T]{framing: framing, length: length, marshal: marshal}
+	s.buf = s.buf[:0]
+}
+
+// SetErrorHandler sets the function that receives the errors that occur when batches are written by Flush.
+func (s *Sink[T]) SetErrorHandler(onError func(error)) {
+	s.onError = onError
+}
+
+// Write encodes a batch and writes it to the io.Writer in one piece, retrying short writes until the whole batch is written. If the batch is empty, then nothing is written. If the batch cannot be encoded or written, then the error is returned; io.ErrShortWrite is returned if the io.Writer stops accepting data without returning an error.
+func (s *Sink[T]) Write(batch []T) error {
+	if len(batch) == 0 {
+		return nil
+	}
+
+	b, err := s.enc.encode(s.buf[:0], batch)
+	s.buf = b
+	if err != nil {
+		return err
+	}
+
+	return writeFull(s.w, b)
+}
+
+// Flush writes a batch and passes any error to the error handler (see SetErrorHandler). It can be used as the flush handler of an AutoFlusher or Keyed aggregate.
+func (s *Sink[T]) Flush(batch []T) {
+	if err := s.Write(batch); err != nil && s.onError != nil {
+		s.onError(err)
+	}
+}
+
+// writeFull writes all of b to w.
+func writeFull(w io.Writer, b []byte) error {
+	for len(b) > 0 {
+		n, err := w.Write(b)
+		if err != nil {
+			return err
+		}
+
+		if n == 0 {
+			return io.ErrShortWrite
+		}
+
+		b = b[n:]
+	}
+
+	return nil
+}
+
+// StringsSink creates a Sink that writes batches of strings to w. See Sink.New.
+func StringsSink(w io.Writer, framing Framing, length LengthPrefix) *Sink[string] {
+	s := &Sink[string]{}
+	s.New(w, framing, length, marshalString)
+
+	return s
+}
+
+// BytesSink creates a Sink that writes batches of bytes to w. See Sink.New.
+func BytesSink(w io.Writer, framing Framing, length LengthPrefix) *Sink[[]byte] {
+	s := &Sink[[]byte]{}
+	s.New(w, framing, length, marshalBytes)
+
+	return s
+}
+
+// JSONSink creates a Sink that writes batches of marshaled JSON objects to w. Objects are written as they are, so the marshaled form kept by a JSON aggregate is not marshaled again; use JSON.EncodedFlush to flush a JSON aggregate to the Sink. See Sink.New.
+func JSONSink(w io.Writer, framing Framing, length LengthPrefix) *Sink[[]byte] {
+	return BytesSink(w, framing, length)
+}
+
+func marshalString(dst []byte, s string) ([]byte, error) {
+	return append(dst, s...), nil
+}
+
+func marshalBytes(dst []byte, b []byte) ([]byte, error) {
+	return append(dst, b...), nil
+}
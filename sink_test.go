@@ -0,0 +1,198 @@
+package aggregate
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// shortWriter writes at most n bytes per call.
+type shortWriter struct {
+	bytes.Buffer
+	n int
+}
+
+func (w *shortWriter) Write(b []byte) (int, error) {
+	if len(b) > w.n {
+		b = b[:w.n]
+	}
+
+	return w.Buffer.Write(b)
+}
+
+// errWriter fails every write.
+type errWriter struct{}
+
+func (errWriter) Write(b []byte) (int, error) {
+	return 0, errors.New("closed")
+}
+
+func TestStringsSink(t *testing.T) {
+	var tests = []struct {
+		name     string
+		framing  Framing
+		length   LengthPrefix
+		data     []string
+		expected string
+	}{
+		{
+			"ndjson",
+			NDJSONFraming,
+			NoLength,
+			[]string{`{"a":1}`, `{"b":2}`},
+			"{\"a\":1}\n{\"b\":2}\n",
+		},
+		{
+			"array",
+			JSONArrayFraming,
+			NoLength,
+			[]string{`1`, `2`, `3`},
+			"[1,2,3]",
+		},
+		{
+			"varint",
+			Framing{},
+			VarintLength,
+			[]string{"foo", strings.Repeat("a", 200)},
+			"\x03foo\xc8\x01" + strings.Repeat("a", 200),
+		},
+		{
+			"uint32",
+			Framing{},
+			Uint32Length,
+			[]string{"foo", ""},
+			"\x00\x00\x00\x03foo\x00\x00\x00\x00",
+		},
+		{
+			"empty",
+			JSONArrayFraming,
+			NoLength,
+			[]string{},
+			"",
+		},
+	}
+
+	for _, test := range tests {
+		// every write is short, so the batch is only written if short writes are retried.
+		w := &shortWriter{n: 2}
+		s := StringsSink(w, test.framing, test.length)
+
+		if err := s.Write(test.data); err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.name, err)
+		}
+
+		if w.String() != test.expected {
+			t.Logf("%s: expected %q, got %q", test.name, test.expected, w.String())
+			t.Fail()
+		}
+	}
+}
+
+func TestSinkLengthRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	s := BytesSink(&buf, Framing{}, VarintLength)
+
+	data := [][]byte{[]byte("foo"), {}, bytes.Repeat([]byte("b"), 1000)}
+	if err := s.Write(data); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range data {
+		n, err := binary.ReadUvarint(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		item := make([]byte, n)
+		if _, err := io.ReadFull(&buf, item); err != nil || !bytes.Equal(item, expected) {
+			t.Logf("expected %q, got %q", expected, item)
+			t.Fail()
+		}
+	}
+}
+
+func TestJSONSink(t *testing.T) {
+	agg := JSON{}
+	agg.New(2, 100, time.Minute)
+
+	var buf bytes.Buffer
+	s := JSONSink(&buf, JSONArrayFraming, NoLength)
+
+	f := AutoFlusher[interface{}]{}
+	f.New(&agg, agg.EncodedFlush(s.Flush))
+
+	for _, data := range []interface{}{map[string]int{"a": 1}, map[string]int{"b": 2}, map[string]int{"c": 3}} {
+		f.Add(data)
+	}
+	f.Close()
+
+	expected := `[{"a":1},{"b":2}][{"c":3}]`
+	if buf.String() != expected {
+		t.Logf("expected %v, got %v", expected, buf.String())
+		t.Fail()
+	}
+
+	// objects are only marshaled when they are added to the aggregate.
+	var m countMarshaler
+	f.New(&agg, agg.EncodedFlush(s.Flush))
+	f.Add(&m)
+	f.Close()
+
+	if m != 1 {
+		t.Logf("expected %v marshal, got %v", 1, int(m))
+		t.Fail()
+	}
+}
+
+// countMarshaler counts the number of times that it is marshaled.
+type countMarshaler int
+
+func (m *countMarshaler) MarshalJSON() ([]byte, error) {
+	*m++
+	return []byte(`{}`), nil
+}
+
+func TestSinkErrors(t *testing.T) {
+	var tests = []struct {
+		name     string
+		w        io.Writer
+		marshal  func([]byte, string) ([]byte, error)
+		expected error
+	}{
+		{
+			"short write",
+			&shortWriter{n: 0},
+			marshalString,
+			io.ErrShortWrite,
+		},
+		{
+			"marshal",
+			&bytes.Buffer{},
+			func(dst []byte, s string) ([]byte, error) { return dst, InvalidJSON },
+			InvalidJSON,
+		},
+	}
+
+	for _, test := range tests {
+		var reported error
+		s := Sink[string]{}
+		s.New(test.w, NDJSONFraming, NoLength, test.marshal)
+		s.SetErrorHandler(func(err error) { reported = err })
+
+		s.Flush([]string{"foo"})
+		if reported != test.expected {
+			t.Logf("%s: expected %v, got %v", test.name, test.expected, reported)
+			t.Fail()
+		}
+	}
+
+	s := StringsSink(errWriter{}, NDJSONFraming, NoLength)
+	if err := s.Write([]string{"foo"}); err == nil || err.Error() != "closed" {
+		t.Logf("expected %v, got %v", "closed", err)
+		t.Fail()
+	}
+}
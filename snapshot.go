@@ -0,0 +1,254 @@
+package aggregate
+
+import (
+	"encoding/binary"
+	"time"
+)
+
+// ErrInvalidSnapshot is returned when the state of an aggregate cannot be restored from a snapshot.
+const ErrInvalidSnapshot = Error("ErrInvalidSnapshot")
+
+// snapshotMagic identifies a snapshot and its format version.
+const snapshotMagic = "AGS\x01"
+
+// snapshot is the state of an aggregate that is captured by MarshalBinary and restored by UnmarshalBinary.
+type snapshot struct {
+	maxCount, maxSize               int
+	maxDuration, maxIdle            time.Duration
+	deadLetterCount, deadLetterSize int
+	start, last                     time.Time
+	sequence                        uint64
+	trigger                         Trigger
+	framing                         Framing
+
+	// items and pending are the records of the items in the payload and the chunks of a split item that have not been added to the payload.
+	items, pending [][]byte
+}
+
+// marshalBinary captures the state of the aggregate, using encode to convert each item into a record.
+func (a *Aggregate[T]) marshalBinary(encode func(T) []byte) ([]byte, error) {
+	items := make([][]byte, 0, a.count)
+
+	it := a.Iter()
+	for it.Next() {
+		items = append(items, encode(it.Item()))
+	}
+
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+
+	return a.snapshot(items, encode).marshal(), nil
+}
+
+// unmarshalBinary initializes the aggregate with the limits of a snapshot and restores its state, using decode to convert each record into an item.
+func (a *Aggregate[T]) unmarshalBinary(b []byte, sizer Sizer[T], decode func([]byte) T) error {
+	s, err := unmarshalSnapshot(b)
+	if err != nil {
+		return err
+	}
+
+	a.New(s.maxCount, s.maxSize, s.maxDuration, sizer)
+	for _, r := range s.items {
+		data := decode(r)
+
+		size, err := sizer(data)
+		if err != nil {
+			return err
+		}
+
+		a.append(data, size)
+	}
+
+	a.restore(s, decode)
+	return nil
+}
+
+// snapshot captures the state of the aggregate. The records of the items in the payload are provided by the caller.
+func (a *Aggregate[T]) snapshot(items [][]byte, encode func(T) []byte) snapshot {
+	s := snapshot{
+		maxCount:        a.maxCount,
+		maxSize:         a.maxSize,
+		maxDuration:     a.maxDuration,
+		maxIdle:         a.maxIdle,
+		deadLetterCount: a.deadLetterCount,
+		deadLetterSize:  a.deadLetterSize,
+		start:           a.start,
+		last:            a.last,
+		sequence:        a.sequence,
+		trigger:         a.trigger,
+		framing:         a.framing,
+		items:           items,
+	}
+
+	for _, chunk := range a.pending {
+		s.pending = append(s.pending, encode(chunk))
+	}
+
+	return s
+}
+
+// restore restores the settings, counters, and times of a snapshot. The items in the payload are added before restore is called.
+func (a *Aggregate[T]) restore(s snapshot, decode func([]byte) T) {
+	a.maxIdle = s.maxIdle
+	a.framing = s.framing
+	a.deadLetterCount, a.deadLetterSize = s.deadLetterCount, s.deadLetterSize
+	a.start, a.last = s.start, s.last
+	a.sequence, a.trigger = s.sequence, s.trigger
+
+	a.pending = nil
+	for _, r := range s.pending {
+		a.pending = append(a.pending, decode(r))
+	}
+}
+
+// marshal encodes a snapshot.
+func (s snapshot) marshal() []byte {
+	b := []byte(snapshotMagic)
+	for _, v := range []int64{
+		int64(s.maxCount),
+		int64(s.maxSize),
+		int64(s.maxDuration),
+		int64(s.maxIdle),
+		int64(s.deadLetterCount),
+		int64(s.deadLetterSize),
+		unixNano(s.start),
+		unixNano(s.last),
+		int64(s.sequence),
+		int64(s.trigger),
+	} {
+		b = appendVarint(b, v)
+	}
+
+	for _, f := range [][]byte{s.framing.Prefix, s.framing.Delimiter, s.framing.Terminator, s.framing.Suffix} {
+		b = appendBytes(b, f)
+	}
+
+	for _, records := range [][][]byte{s.items, s.pending} {
+		b = appendVarint(b, int64(len(records)))
+		for _, r := range records {
+			b = appendBytes(b, r)
+		}
+	}
+
+	return b
+}
+
+// unmarshalSnapshot decodes a snapshot.
+func unmarshalSnapshot(b []byte) (snapshot, error) {
+	var s snapshot
+	if len(b) < len(snapshotMagic) {
+		return s, ErrInvalidSnapshot
+	}
+
+	if string(b[:len(snapshotMagic)]) != snapshotMagic {
+		return s, ErrInvalidSnapshot
+	}
+
+	d := decoder{b: b[len(snapshotMagic):]}
+	s.maxCount = int(d.varint())
+	s.maxSize = int(d.varint())
+	s.maxDuration = time.Duration(d.varint())
+	s.maxIdle = time.Duration(d.varint())
+	s.deadLetterCount = int(d.varint())
+	s.deadLetterSize = int(d.varint())
+	s.start = fromUnixNano(d.varint())
+	s.last = fromUnixNano(d.varint())
+	s.sequence = uint64(d.varint())
+	s.trigger = Trigger(d.varint())
+
+	s.framing.Prefix = d.bytes()
+	s.framing.Delimiter = d.bytes()
+	s.framing.Terminator = d.bytes()
+	s.framing.Suffix = d.bytes()
+
+	for _, records := range []*[][]byte{&s.items, &s.pending} {
+		n := d.varint()
+		if n < 0 || n > int64(len(d.b)) {
+			return s, ErrInvalidSnapshot
+		}
+
+		for i := int64(0); i < n; i++ {
+			*records = append(*records, d.bytes())
+		}
+	}
+
+	if d.err != nil || len(d.b) != 0 {
+		return s, ErrInvalidSnapshot
+	}
+
+	return s, nil
+}
+
+// decoder reads the fields of a snapshot. Once an error occurs, all further reads return zero values.
+type decoder struct {
+	b   []byte
+	err error
+}
+
+func (d *decoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+
+	v, n := binary.Varint(d.b)
+	if n <= 0 {
+		d.err = ErrInvalidSnapshot
+		return 0
+	}
+
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *decoder) bytes() []byte {
+	n := d.varint()
+	if d.err != nil {
+		return nil
+	}
+
+	if n < 0 || n > int64(len(d.b)) {
+		d.err = ErrInvalidSnapshot
+		return nil
+	}
+
+	if n == 0 {
+		return nil
+	}
+
+	b := make([]byte, n)
+	copy(b, d.b)
+	d.b = d.b[n:]
+
+	return b
+}
+
+func appendVarint(dst []byte, v int64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutVarint(buf[:], v)
+
+	return append(dst, buf[:n]...)
+}
+
+func appendBytes(dst, b []byte) []byte {
+	dst = appendVarint(dst, int64(len(b)))
+	return append(dst, b...)
+}
+
+// unixNano returns the Unix time of t in nanoseconds, or zero if t is the zero time.
+func unixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+
+	return t.UnixNano()
+}
+
+// fromUnixNano returns the time of a Unix time in nanoseconds, or the zero time if ns is zero.
+func fromUnixNano(ns int64) time.Time {
+	if ns == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(0, ns)
+}
@@ -0,0 +1,151 @@
+package aggregate
+
+import (
+	"encoding"
+	"testing"
+	"time"
+)
+
+var (
+	_ encoding.BinaryMarshaler   = (*Strings)(nil)
+	_ encoding.BinaryUnmarshaler = (*Bytes)(nil)
+	_ encoding.BinaryMarshaler   = (*JSON)(nil)
+)
+
+func TestStringsSnapshot(t *testing.T) {
+	var tests = []struct {
+		data []string
+	}{
+		{
+			[]string{"foo", "bar", "baz"},
+		},
+		{
+			[]string{},
+		},
+	}
+
+	for _, test := range tests {
+		agg := Strings{}
+		agg.New(5, 100, time.Minute)
+		agg.SetMaxIdle(time.Second)
+		agg.SetFraming(NDJSONFraming)
+
+		for _, data := range test.data {
+			agg.Add(data)
+		}
+
+		b, err := agg.MarshalBinary()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		restored := Strings{}
+		if err := restored.UnmarshalBinary(b); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		expected, _ := agg.Encode()
+		payload, _ := restored.Encode()
+		if restored.Count() != agg.Count() || restored.Size() != agg.Size() || string(payload) != string(expected) {
+			t.Logf("expected %q, got %q", expected, payload)
+			t.Fail()
+		}
+
+		if !restored.start.Equal(agg.start) || restored.maxIdle != agg.maxIdle || restored.maxCount != agg.maxCount || restored.maxDuration != agg.maxDuration {
+			t.Logf("expected settings to be restored")
+			t.Fail()
+		}
+
+		// the restored aggregate continues to enforce the limits of the original.
+		for restored.Add("qux") == nil {
+		}
+		if restored.Count() != 5 {
+			t.Logf("expected %v, got %v", 5, restored.Count())
+			t.Fail()
+		}
+	}
+}
+
+func TestBytesSnapshotSpill(t *testing.T) {
+	agg := Bytes{}
+	agg.New(100, 100, time.Minute)
+	agg.SetSpill(t.TempDir(), 4)
+
+	for _, data := range []string{"foo", "bar", "baz"} {
+		agg.Add([]byte(data))
+	}
+
+	b, err := agg.MarshalBinary()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	restored := Bytes{}
+	restored.UnmarshalBinary(b)
+
+	payload := restored.Get()
+	if len(payload) != 3 || string(payload[0]) != "foo" || string(payload[2]) != "baz" {
+		t.Logf("expected %v items, got %v", 3, len(payload))
+		t.Fail()
+	}
+}
+
+func TestJSONSnapshot(t *testing.T) {
+	agg := JSON{}
+	agg.New(100, 100, time.Minute)
+	agg.Add(map[string]string{"foo": "bar"})
+	agg.Add([]int{1, 2, 3})
+
+	b, _ := agg.MarshalBinary()
+
+	restored := JSON{}
+	if err := restored.UnmarshalBinary(b); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if string(restored.Array()) != string(agg.Array()) || restored.Size() != agg.Size() {
+		t.Logf("expected %v, got %v", string(agg.Array()), string(restored.Array()))
+		t.Fail()
+	}
+}
+
+func TestSnapshotInvalid(t *testing.T) {
+	agg := Strings{}
+	agg.New(100, 100, time.Minute)
+	agg.Add("foo")
+	b, _ := agg.MarshalBinary()
+
+	for _, data := range [][]byte{nil, []byte("foo"), b[:len(b)-1], append(b, 0)} {
+		restored := Strings{}
+		if err := restored.UnmarshalBinary(data); err != ErrInvalidSnapshot {
+			t.Logf("expected %v, got %v", ErrInvalidSnapshot, err)
+			t.Fail()
+		}
+	}
+}
+
+func TestSnapshotSequence(t *testing.T) {
+	agg := Strings{}
+	agg.New(1, 100, time.Minute)
+
+	for _, data := range []string{"foo", "bar", "baz"} {
+		if err := agg.Add(data); err != nil {
+			agg.Reset()
+			agg.Add(data)
+		}
+	}
+
+	// the payload is full, so the trigger of the payload is restored along with its sequence number.
+	agg.Add("qux")
+
+	b, _ := agg.MarshalBinary()
+	restored := Strings{}
+	if err := restored.UnmarshalBinary(b); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if batch := restored.Batch(); batch.Sequence != 3 || batch.Trigger != TriggerCount {
+		t.Logf("expected sequence 3 and trigger count, got %v and %v", batch.Sequence, batch.Trigger)
+		t.Fail()
+	}
+}
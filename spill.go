@@ -0,0 +1,197 @@
+package aggregate
+
+import (
+	"bufio"
+	"io"
+	"os"
+)
+
+// spill holds the settings and state of an aggregate that writes items to temporary segment files.
+type spill[T any] struct {
+	dir       string
+	maxMemory int
+	encode    func(T) []byte
+	decode    func([]byte) T
+
+	// memory is the size of the items held in memory and segments are the paths of the segment files, from oldest to newest.
+	memory   int
+	segments []string
+	buf      []byte
+	// err is the error that occurred when Get last read the segment files.
+	err error
+}
+
+/*
+SetSpill enables writing items to temporary segment files in dir when the size of the items held in memory would exceed maxMemory. The items held in memory are written to a new segment file and new items are held in memory until the limit is reached again. The functions encode and decode are used to convert items to and from the records stored in segment files.
+
+When items have been written to segment files, the payload should be read with an Iterator (see Iter). Segment files are removed when the aggregate is reset. Aggregates that keep other state for each item, such as JSON, do not support spilling.
+*/
+func (a *Aggregate[T]) SetSpill(dir string, maxMemory int, encode func(T) []byte, decode func([]byte) T) {
+	a.spill = &spill[T]{
+		dir:       dir,
+		maxMemory: maxMemory,
+		encode:    encode,
+		decode:    decode,
+	}
+}
+
+// Iter returns an Iterator over the aggregate payload, including items written to segment files. The Iterator is only valid until the next item is added or the aggregate is reset.
+func (a *Aggregate[T]) Iter() *Iterator[T] {
+	it := &Iterator[T]{items: a.items}
+	if a.spill != nil {
+		it.segments = a.spill.segments
+		it.decode = a.spill.decode
+	}
+
+	return it
+}
+
+// Err returns the error, if any, that occurred when Get last read items from segment files (see SetSpill). If it is not nil, then the payload returned by Get is incomplete. It is cleared when the aggregate is reset.
+func (a *Aggregate[T]) Err() error {
+	if a.spill == nil {
+		return nil
+	}
+
+	return a.spill.err
+}
+
+// encodeFramed returns the payload of an aggregate encoded with its framing, including items written to segment files. If a segment file cannot be read, then the error is returned.
+func encodeFramed[T string | []byte](a *Aggregate[T]) ([]byte, error) {
+	items := a.Get()
+	if err := a.Err(); err != nil {
+		return nil, err
+	}
+
+	return appendFramed(a.framing, make([]byte, 0, a.Size()), items), nil
+}
+
+// spillItems writes the items held in memory to a new segment file.
+func (a *Aggregate[T]) spillItems() error {
+	f, err := os.CreateTemp(a.spill.dir, "aggregate-*.seg")
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	for _, item := range a.items {
+		a.spill.buf = appendRecord(a.spill.buf[:0], a.spill.encode(item))
+		if _, err = w.Write(a.spill.buf); err != nil {
+			break
+		}
+	}
+
+	if err == nil {
+		err = w.Flush()
+	}
+
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	a.spill.segments = append(a.spill.segments, f.Name())
+	a.spill.memory = 0
+
+	// the items are cleared so that they can be garbage collected.
+	var zero T
+	for i := range a.items {
+		a.items[i] = zero
+	}
+	a.items = a.items[:0]
+
+	if a.release != nil {
+		a.release()
+	}
+
+	return nil
+}
+
+// removeSegments removes all segment files.
+func (a *Aggregate[T]) removeSegments() {
+	for _, path := range a.spill.segments {
+		os.Remove(path)
+	}
+
+	a.spill.segments = a.spill.segments[:0]
+	a.spill.memory = 0
+	a.spill.err = nil
+}
+
+// Iterator reads the items of an aggregate payload, including items that were written to segment files.
+type Iterator[T any] struct {
+	segments []string
+	decode   func([]byte) T
+	items    []T
+
+	f    *os.File
+	r    *bufio.Reader
+	item T
+	err  error
+}
+
+// Next advances the Iterator to the next item, which is then available through Item. It returns false when there are no more items or an error occurs.
+func (it *Iterator[T]) Next() bool {
+	if it.err != nil {
+		return false
+	}
+
+	for len(it.segments) > 0 || it.r != nil {
+		if it.r == nil {
+			f, err := os.Open(it.segments[0])
+			if err != nil {
+				it.err = err
+				return false
+			}
+
+			it.f = f
+			it.r = bufio.NewReader(f)
+			it.segments = it.segments[1:]
+		}
+
+		b, err := readRecord(it.r)
+		if err == nil {
+			it.item = it.decode(b)
+			return true
+		}
+
+		it.Close()
+		if err != io.EOF {
+			it.err = err
+			return false
+		}
+	}
+
+	if len(it.items) > 0 {
+		it.item = it.items[0]
+		it.items = it.items[1:]
+		return true
+	}
+
+	return false
+}
+
+// Item returns the current item.
+func (it *Iterator[T]) Item() T {
+	return it.item
+}
+
+// Err returns the error, if any, that occurred while reading the segment files.
+func (it *Iterator[T]) Err() error {
+	return it.err
+}
+
+// Close closes the segment file that is being read. It only needs to be called if the Iterator is not read until Next returns false.
+func (it *Iterator[T]) Close() error {
+	if it.f == nil {
+		return nil
+	}
+
+	err := it.f.Close()
+	it.f, it.r = nil, nil
+
+	return err
+}
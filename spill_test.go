@@ -0,0 +1,140 @@
+package aggregate
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestBytesSpill(t *testing.T) {
+	var tests = []struct {
+		maxMemory int
+		items     int
+		segments  int
+	}{
+		{10, 10, 4},
+		{100, 10, 0},
+		{1, 5, 4},
+	}
+
+	for _, test := range tests {
+		dir := t.TempDir()
+
+		agg := Bytes{}
+		agg.New(100, 1000, time.Minute)
+		agg.SetSpill(dir, test.maxMemory)
+
+		var expected []string
+		for i := 0; i < test.items; i++ {
+			data := fmt.Sprintf("i%03d", i)
+			if err := agg.Add([]byte(data)); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			expected = append(expected, data)
+		}
+
+		files, _ := os.ReadDir(dir)
+		if len(files) != test.segments {
+			t.Logf("expected %v segments, got %v", test.segments, len(files))
+			t.Fail()
+		}
+
+		if agg.Count() != test.items || agg.Size() != 4*test.items {
+			t.Logf("expected %v items, got %v", test.items, agg.Count())
+			t.Fail()
+		}
+
+		it := agg.Iter()
+		i := 0
+		for it.Next() {
+			if string(it.Item()) != expected[i] {
+				t.Logf("expected %v, got %v", expected[i], string(it.Item()))
+				t.Fail()
+			}
+			i++
+		}
+
+		if it.Err() != nil || i != test.items {
+			t.Logf("expected %v items, got %v (%v)", test.items, i, it.Err())
+			t.Fail()
+		}
+
+		payload := agg.Get()
+		for i, p := range payload {
+			if string(p) != expected[i] {
+				t.Logf("expected %v, got %v", expected[i], string(p))
+				t.Fail()
+			}
+		}
+
+		agg.Reset()
+		if files, _ := os.ReadDir(dir); len(files) != 0 {
+			t.Logf("expected segments to be removed, got %v", len(files))
+			t.Fail()
+		}
+	}
+}
+
+func TestStringsSpillCorrupt(t *testing.T) {
+	dir := t.TempDir()
+
+	agg := Strings{}
+	agg.New(100, 1000, time.Minute)
+	agg.SetSpill(dir, 3)
+	agg.Add("foo")
+	agg.Add("bar")
+
+	files, _ := os.ReadDir(dir)
+	os.WriteFile(dir+"/"+files[0].Name(), []byte("\x00\x00\x00\x03\x00\x00\x00\x00foo"), 0o644)
+
+	it := agg.Iter()
+	for it.Next() {
+	}
+
+	if it.Err() != ErrCorruptRecord {
+		t.Logf("expected %v, got %v", ErrCorruptRecord, it.Err())
+		t.Fail()
+	}
+
+	// Get cannot return the error, so it is recorded.
+	if payload := agg.Get(); len(payload) == agg.Count() || agg.Err() != ErrCorruptRecord {
+		t.Logf("expected an incomplete payload and %v, got %v and %v", ErrCorruptRecord, payload, agg.Err())
+		t.Fail()
+	}
+
+	if _, err := agg.Encode(); err != ErrCorruptRecord {
+		t.Logf("expected %v, got %v", ErrCorruptRecord, err)
+		t.Fail()
+	}
+
+	agg.Reset()
+	if agg.Err() != nil {
+		t.Logf("expected %v, got %v", nil, agg.Err())
+		t.Fail()
+	}
+}
+
+// TestStringsSpillEncode tests that items written to segment files are included in the encoded payload.
+func TestStringsSpillEncode(t *testing.T) {
+	agg := Strings{}
+	agg.New(100, 1000, time.Minute)
+	agg.SetFraming(NDJSONFraming)
+	agg.SetSpill(t.TempDir(), 4)
+
+	for _, data := range []string{"foo", "bar", "baz"} {
+		if err := agg.Add(data); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	payload, err := agg.Encode()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if string(payload) != "foo\nbar\nbaz\n" || len(payload) != agg.Size() {
+		t.Logf("expected %q, got %q", "foo\nbar\nbaz\n", payload)
+		t.Fail()
+	}
+}
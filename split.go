@@ -0,0 +1,191 @@
+package aggregate
+
+import (
+	"container/list"
+	"crypto/rand"
+	"encoding/binary"
+	"hash/crc32"
+	"sync/atomic"
+)
+
+// ErrInvalidChunk is returned when a chunk cannot be reassembled into an item.
+const ErrInvalidChunk = Error("ErrInvalidChunk")
+
+// DefaultMaxPending is the maximum number of items that a Reassembler holds until all of their chunks have been added, unless it is changed with SetMaxPending.
+const DefaultMaxPending = 1024
+
+// chunkMagic identifies the header of a chunk. The header ends with a checksum of the magic and the fields of the header, so items that happen to start with the magic are not mistaken for chunks.
+const chunkMagic = "\x1eAGCHNK"
+
+// ChunkHeaderSize is the size of the header that is prepended to each chunk of a split item.
+const ChunkHeaderSize = len(chunkMagic) + 8 + 4 + 4 + 4
+
+// chunkID is the ID of the last split item. It is seeded randomly so that IDs from different processes are unlikely to collide.
+var chunkID uint64
+
+func init() {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err == nil {
+		chunkID = binary.BigEndian.Uint64(b[:])
+	}
+}
+
+// Chunk is a part of an item that was split because it was larger than the maximum size of an aggregate.
+type Chunk struct {
+	// ID identifies the item that the chunk was split from.
+	ID uint64
+	// Index is the position of the chunk in the item, starting from zero.
+	Index int
+	// Total is the number of chunks that the item was split into.
+	Total int
+	// Data is the part of the item stored in the chunk.
+	Data []byte
+}
+
+// ParseChunk parses the header of a chunk. If b is not a chunk, then false is returned.
+func ParseChunk(b []byte) (Chunk, bool) {
+	if len(b) < ChunkHeaderSize || string(b[:len(chunkMagic)]) != chunkMagic {
+		return Chunk{}, false
+	}
+
+	if crc32.ChecksumIEEE(b[:ChunkHeaderSize-4]) != binary.BigEndian.Uint32(b[ChunkHeaderSize-4:]) {
+		return Chunk{}, false
+	}
+
+	h := b[len(chunkMagic):]
+	return Chunk{
+		ID:    binary.BigEndian.Uint64(h[0:8]),
+		Index: int(binary.BigEndian.Uint32(h[8:12])),
+		Total: int(binary.BigEndian.Uint32(h[12:16])),
+		Data:  b[ChunkHeaderSize:],
+	}, true
+}
+
+// splitItem splits an item into chunks that are no larger than size, including the chunk header.
+func splitItem[T string | []byte](data T, size int) []T {
+	n := size - ChunkHeaderSize
+	total := (len(data) + n - 1) / n
+	id := atomic.AddUint64(&chunkID, 1)
+
+	chunks := make([]T, 0, total)
+	for i := 0; i < total; i++ {
+		end := (i + 1) * n
+		if end > len(data) {
+			end = len(data)
+		}
+
+		b := make([]byte, ChunkHeaderSize, ChunkHeaderSize+end-i*n)
+		copy(b, chunkMagic)
+		h := b[len(chunkMagic):]
+		binary.BigEndian.PutUint64(h[0:8], id)
+		binary.BigEndian.PutUint32(h[8:12], uint32(i))
+		binary.BigEndian.PutUint32(h[12:16], uint32(total))
+		binary.BigEndian.PutUint32(h[16:20], crc32.ChecksumIEEE(b[:ChunkHeaderSize-4]))
+		b = append(b, data[i*n:end]...)
+
+		chunks = append(chunks, T(b))
+	}
+
+	return chunks
+}
+
+// Reassembler reassembles chunks of split items into the original items. Items whose chunks are never all added, such as when a chunk is lost, are held until they are evicted (see SetMaxPending) or dropped (see Drop).
+type Reassembler struct {
+	maxPending int
+	evicted    int
+
+	// items holds the elements of order for each pending item, which is ordered from the oldest to the newest item.
+	items map[uint64]*list.Element
+	order list.List
+}
+
+// pendingItem holds the chunks of an item that have been added to a Reassembler. The chunks are stored by their index, so the memory held for an item only depends on the chunks that have been added and not on the number of chunks in its header.
+type pendingItem struct {
+	id    uint64
+	total int
+	parts map[int][]byte
+	size  int
+}
+
+// SetMaxPending sets the maximum number of items that are held until all of their chunks have been added. When a chunk of a new item is added and the maximum is reached, the oldest pending item is evicted and its chunks are discarded (see Evicted). A value of zero uses DefaultMaxPending.
+func (r *Reassembler) SetMaxPending(maxPending int) {
+	r.maxPending = maxPending
+	r.evict()
+}
+
+/*
+Add adds an item retrieved from an aggregate to the Reassembler. If the item is not a chunk, then it is returned as is. If the item is a chunk and all chunks of the original item have been added, then the original item is returned; otherwise nil is returned.
+
+If the chunk is not consistent with other chunks of the same item, then ErrInvalidChunk is returned.
+*/
+func (r *Reassembler) Add(b []byte) ([]byte, error) {
+	c, ok := ParseChunk(b)
+	if !ok {
+		return b, nil
+	}
+
+	if c.Total == 0 || c.Index >= c.Total {
+		return nil, ErrInvalidChunk
+	}
+
+	if r.items == nil {
+		r.items = make(map[uint64]*list.Element)
+	}
+
+	e, ok := r.items[c.ID]
+	if !ok {
+		e = r.order.PushBack(&pendingItem{id: c.ID, total: c.Total, parts: make(map[int][]byte)})
+		r.items[c.ID] = e
+		r.evict()
+	}
+
+	p := e.Value.(*pendingItem)
+	if _, ok := p.parts[c.Index]; ok || p.total != c.Total {
+		return nil, ErrInvalidChunk
+	}
+	p.parts[c.Index] = append([]byte{}, c.Data...)
+	p.size += len(c.Data)
+
+	if len(p.parts) < p.total {
+		return nil, nil
+	}
+
+	item := make([]byte, 0, p.size)
+	for i := 0; i < p.total; i++ {
+		item = append(item, p.parts[i]...)
+	}
+	r.Drop(c.ID)
+
+	return item, nil
+}
+
+// Drop discards the chunks of a pending item, such as an item whose remaining chunks will never be added. If no item with the ID is pending, then Drop does nothing.
+func (r *Reassembler) Drop(id uint64) {
+	if e, ok := r.items[id]; ok {
+		r.order.Remove(e)
+		delete(r.items, id)
+	}
+}
+
+// Pending returns the number of items that have not been fully reassembled.
+func (r *Reassembler) Pending() int {
+	return len(r.items)
+}
+
+// Evicted returns the number of pending items that were evicted because the maximum number of pending items was reached (see SetMaxPending).
+func (r *Reassembler) Evicted() int {
+	return r.evicted
+}
+
+// evict evicts the oldest pending items until no more than the maximum number of items are pending.
+func (r *Reassembler) evict() {
+	maxPending := r.maxPending
+	if maxPending == 0 {
+		maxPending = DefaultMaxPending
+	}
+
+	for len(r.items) > maxPending {
+		r.Drop(r.order.Front().Value.(*pendingItem).id)
+		r.evicted++
+	}
+}
@@ -0,0 +1,202 @@
+package aggregate
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBytesSplit(t *testing.T) {
+	var tests = []struct {
+		name    string
+		maxSize int
+		framing Framing
+		data    [][]byte
+	}{
+		{
+			"oversized",
+			64,
+			Framing{},
+			[][]byte{
+				[]byte("foo"),
+				bytes.Repeat([]byte("abcdefgh"), 40),
+				[]byte("bar"),
+			},
+		},
+		{
+			"framed",
+			50,
+			NDJSONFraming,
+			[][]byte{
+				bytes.Repeat([]byte("x"), 101),
+				[]byte("baz"),
+				bytes.Repeat([]byte("y"), 31),
+			},
+		},
+	}
+
+	for _, test := range tests {
+		agg := Bytes{}
+		agg.New(100, test.maxSize, time.Minute)
+		agg.SetFraming(test.framing)
+		agg.SetSplit(true)
+
+		r := Reassembler{}
+		var items [][]byte
+		flush := func() {
+			if agg.Size() > test.maxSize {
+				t.Logf("%s: expected %v to be at most %v", test.name, agg.Size(), test.maxSize)
+				t.Fail()
+			}
+
+			for _, b := range agg.Get() {
+				item, err := r.Add(b)
+				if err != nil {
+					t.Fatalf("%s: unexpected error: %v", test.name, err)
+				}
+
+				if item != nil {
+					items = append(items, item)
+				}
+			}
+			agg.Reset()
+		}
+
+		for _, data := range test.data {
+			for {
+				err := agg.Add(data)
+				if err == nil {
+					break
+				}
+
+				if err != ErrSizeExceeded {
+					t.Fatalf("%s: unexpected error: %v", test.name, err)
+				}
+				flush()
+			}
+		}
+
+		for agg.Count() > 0 {
+			flush()
+		}
+
+		if len(items) != len(test.data) || r.Pending() != 0 {
+			t.Fatalf("%s: expected %v items, got %v", test.name, len(test.data), len(items))
+		}
+
+		for i, item := range items {
+			if !bytes.Equal(item, test.data[i]) {
+				t.Logf("%s: expected %s, got %s", test.name, test.data[i], item)
+				t.Fail()
+			}
+		}
+	}
+}
+
+func TestStringsSplit(t *testing.T) {
+	data := strings.Repeat("foobarbaz", 20)
+
+	agg := Strings{}
+	agg.New(100, 2*ChunkHeaderSize, time.Minute)
+
+	if err := agg.Add(data); err != ErrItemTooLarge {
+		t.Logf("expected %v, got %v", ErrItemTooLarge, err)
+		t.Fail()
+	}
+
+	agg.SetSplit(true)
+	if err := agg.Add(data); err != nil {
+		t.Logf("unexpected error: %v", err)
+		t.Fail()
+	}
+
+	r := Reassembler{}
+	var item []byte
+	for agg.Count() > 0 {
+		c, ok := ParseChunk([]byte(agg.Get()[0]))
+		if !ok || c.Total != (len(data)+ChunkHeaderSize-1)/ChunkHeaderSize {
+			t.Logf("unexpected chunk: %+v", c)
+			t.Fail()
+		}
+
+		item, _ = r.Add([]byte(agg.Get()[0]))
+		agg.Reset()
+	}
+
+	if string(item) != data {
+		t.Logf("expected %v, got %v", data, string(item))
+		t.Fail()
+	}
+}
+
+func TestReassemblerInvalid(t *testing.T) {
+	chunks := splitItem([]byte("foobarbaz"), ChunkHeaderSize+3)
+
+	r := Reassembler{}
+	r.Add(chunks[0])
+	if _, err := r.Add(chunks[0]); err != ErrInvalidChunk {
+		t.Logf("expected %v, got %v", ErrInvalidChunk, err)
+		t.Fail()
+	}
+
+	// items that start with the magic but do not have a valid header are not chunks.
+	for _, data := range []string{chunkMagic + "foo", chunkMagic + strings.Repeat("\xff", ChunkHeaderSize)} {
+		if item, err := r.Add([]byte(data)); err != nil || string(item) != data {
+			t.Logf("expected %q, got %q (%v)", data, item, err)
+			t.Fail()
+		}
+	}
+
+	// the memory held for an item does not depend on the number of chunks in its header.
+	huge := splitItem([]byte("foo"), ChunkHeaderSize+3)[0]
+	binary.BigEndian.PutUint32(huge[len(chunkMagic)+12:], math.MaxUint32)
+	binary.BigEndian.PutUint32(huge[ChunkHeaderSize-4:], crc32.ChecksumIEEE(huge[:ChunkHeaderSize-4]))
+	if item, err := r.Add(huge); item != nil || err != nil || r.Pending() != 2 {
+		t.Logf("expected a pending item, got %q (%v) and %v pending", item, err, r.Pending())
+		t.Fail()
+	}
+}
+
+// TestReassemblerEvict tests that items that are missing chunks are evicted once the maximum number of pending items is reached.
+func TestReassemblerEvict(t *testing.T) {
+	r := Reassembler{}
+	r.SetMaxPending(2)
+
+	var items [][][]byte
+	for _, data := range []string{"foobarbaz", "quxquuxcorge", "graultgarply"} {
+		items = append(items, splitItem([]byte(data), ChunkHeaderSize+3))
+	}
+
+	// the first chunk of each item is added, so the oldest item is evicted when the third item is added.
+	for _, chunks := range items {
+		if _, err := r.Add(chunks[0]); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if r.Pending() != 2 || r.Evicted() != 1 {
+		t.Logf("expected 2 pending and 1 evicted, got %v pending and %v evicted", r.Pending(), r.Evicted())
+		t.Fail()
+	}
+
+	var item []byte
+	for _, chunk := range items[1][1:] {
+		item, _ = r.Add(chunk)
+	}
+
+	if string(item) != "quxquuxcorge" {
+		t.Logf("expected %v, got %v", "quxquuxcorge", string(item))
+		t.Fail()
+	}
+
+	c, _ := ParseChunk(items[2][0])
+	r.Drop(c.ID)
+	if r.Pending() != 0 {
+		t.Logf("expected 0 pending, got %v", r.Pending())
+		t.Fail()
+	}
+}
@@ -4,12 +4,7 @@ import "time"
 
 // Strings is an intermediary structure for storing strings.
 type Strings struct {
-	count, maxCount int
-	size, maxSize   int
-	maxDuration     time.Duration
-
-	now   time.Time
-	items []string
+	Aggregate[string]
 }
 
 /*
@@ -19,68 +14,60 @@ New initializes a new Strings aggregate with these settings:
 	maxSize:
 		the maximum size of all strings stored in the aggregate; when this value is reached, no more strings can be added to the payload.
 	maxDuration:
-		the maximum duration that the aggregate will store strings; when this duration is reached, no more strings can be added to the payload.
+		the maximum duration that the aggregate will store strings, measured from when the first item was added; when this duration is reached, no more strings can be added to the payload.
 */
 func (a *Strings) New(maxCount, maxSize int, maxDuration time.Duration) {
-	a.count, a.size = 0, 0
-	a.maxCount = maxCount
-	a.maxSize = maxSize
-	a.maxDuration = maxDuration
-
-	a.now = time.Now()
-	a.items = make([]string, 0, a.maxCount)
-}
-
-// Reset resets a Strings aggregate to its initialized settings.
-func (a *Strings) Reset() {
-	a.count, a.size = 0, 0
-
-	a.now = time.Now()
-	a.items = a.items[:0]
+	a.Aggregate.New(maxCount, maxSize, maxDuration, stringSize)
 }
 
 /*
-Add adds a string to the aggregate payload, returning true if the add succeeded and false if the add failed.
-
-If an add attempt fails and the payload is not empty, then the payload should be retrieved (see Get), the aggregate reset (see Reset), and the failed string should be reattempted.
+SetSplit enables or disables splitting of items that are larger than the maximum size of the aggregate. When enabled, these items are split into chunks that each fit in an empty payload, and each chunk is prefixed with a header that identifies the item that it was split from (see ParseChunk and Reassembler).
 
-If an add attempt fails and the payload is empty, then the string being added exceeds the configured limits of the aggregate and should not be reattempted.
+The first chunk is added to the payload and the remaining chunks are added one at a time each time the aggregate is reset. Until all chunks have been added, adding any other item fails with ErrSizeExceeded, so the payload should be retrieved until Count returns zero.
 */
-func (a *Strings) Add(data string) bool {
-	newCount := a.count + 1
-	if newCount > a.maxCount {
-		return false
+func (a *Strings) SetSplit(enabled bool) {
+	a.split = nil
+	if enabled {
+		a.split = splitItem[string]
 	}
+}
 
-	newSize := a.size + len(data)
-	if newSize > a.maxSize {
-		return false
-	}
+// SetWAL sets the write-ahead log that every string added to the aggregate is appended to. See Aggregate.SetWAL and Aggregate.Recover.
+func (a *Strings) SetWAL(wal *WAL) {
+	a.Aggregate.SetWAL(wal, stringEncode, stringDecode)
+}
 
-	if time.Since(a.now) > a.maxDuration {
-		return false
-	}
+// SetSpill enables writing strings to temporary segment files in dir when the size of the strings held in memory would exceed maxMemory. See Aggregate.SetSpill and Aggregate.Iter.
+func (a *Strings) SetSpill(dir string, maxMemory int) {
+	a.Aggregate.SetSpill(dir, maxMemory, stringEncode, stringDecode)
+}
 
-	a.size = newSize
-	a.count = newCount
+// MarshalBinary captures the state of the aggregate, including the payload, counters, limits, and the time when the first item was added. It implements encoding.BinaryMarshaler.
+func (a *Strings) MarshalBinary() ([]byte, error) {
+	return a.marshalBinary(stringEncode)
+}
 
-	a.now = time.Now()
-	a.items = append(a.items, data)
+// UnmarshalBinary initializes the aggregate and restores the state captured by MarshalBinary. Settings that refer to local resources, such as the write-ahead log, are not restored. It implements encoding.BinaryUnmarshaler.
+func (a *Strings) UnmarshalBinary(b []byte) error {
+	return a.unmarshalBinary(b, stringSize, stringDecode)
+}
 
-	return true
+// Encode returns the aggregate payload encoded with the framing of the aggregate (see SetFraming), including items that were written to segment files (see SetSpill). If a segment file cannot be read, then the error is returned.
+func (a *Strings) Encode() ([]byte, error) {
+	return encodeFramed(&a.Aggregate)
 }
 
-// Get returns the aggregate payload.
-func (a *Strings) Get() []string {
-	return a.items
+// stringSize calculates the size of a string.
+func stringSize(s string) (int, error) {
+	return len(s), nil
 }
 
-// Count returns the number of strings in the aggregate payload.
-func (a *Strings) Count() int {
-	return a.count
+// stringEncode converts a string into a record.
+func stringEncode(s string) []byte {
+	return []byte(s)
 }
 
-// Size returns the total size of the strings in the aggregate payload.
-func (a *Strings) Size() int {
-	return a.size
+// stringDecode converts a record into a string.
+func stringDecode(b []byte) string {
+	return string(b)
 }
@@ -3,10 +3,12 @@ package aggregate
 import (
 	"testing"
 	"time"
+
+	"github.com/jshlbrd/go-aggregate/aggregatetest"
 )
 
 // TestStringsTimeout tests that the timeout is respected by configuring
-// a timeout of 1ms and sleeping for 1ms between each Add() call.
+// a timeout of 1ms and advancing the clock by 2ms between each Add() call.
 func TestStringsTimeout(t *testing.T) {
 	var tests = []struct {
 		data     []string
@@ -29,12 +31,14 @@ func TestStringsTimeout(t *testing.T) {
 			t.Fail()
 		}
 
+		clock := aggregatetest.NewClock(time.Unix(0, 0))
 		agg := Strings{}
+		agg.SetClock(clock)
 		agg.New(100, 100, dur)
 
 		for _, data := range test.data {
 			agg.Add(data)
-			time.Sleep(1 * time.Millisecond)
+			clock.Advance(2 * time.Millisecond)
 		}
 
 		if agg.Count() != test.expected {
@@ -0,0 +1,121 @@
+package aggregate
+
+/*
+Swap removes and returns the aggregate payload and resets the aggregate, which continues with a different buffer. Unlike the payload returned by Get, the returned payload belongs to the caller and stays valid after items are added to the aggregate, so it can be delivered asynchronously while new items are added. If the payload is empty, then nil is returned and the aggregate is not reset.
+
+A payload that has been delivered can be returned with Release so that its buffer is used by the next Swap; otherwise, a new buffer is allocated for each payload.
+
+If a write-ahead log is set (see SetWAL), then Swap does not truncate it: the records of the payload are kept until the payload is released, which acknowledges that it was delivered, so a payload that is lost in a crash before it is delivered is recovered again. Payloads that are swapped with a write-ahead log must be released once they are delivered, or the log grows until the aggregate is reset.
+*/
+func (a *Aggregate[T]) Swap() []T {
+	if a.count == 0 {
+		return nil
+	}
+
+	// if items have been written to segment files, then Get returns a new buffer and the current buffer is reused.
+	batch := a.Get()
+	if a.spill == nil || len(a.spill.segments) == 0 {
+		a.items = a.spare
+		a.spare = nil
+		if a.items == nil {
+			a.items = make([]T, 0, initialCapacity(a.maxCount))
+		}
+	}
+
+	// memory that is owned by the aggregate and holds the payload is handed to the caller instead of being reused.
+	if a.detach != nil {
+		a.detach()
+	}
+
+	if a.wal != nil {
+		a.holdRecords(batch)
+	}
+
+	a.reset(false)
+	return batch
+}
+
+/*
+Release returns a payload that was returned by Swap so that its buffer can be reused. The payload must not be used after it is released.
+
+If a write-ahead log is set, then releasing a payload acknowledges that it was delivered. Its records are removed from the log once every payload that was swapped before it has also been released; if the log cannot be rewritten, then the records are kept and the payload may be recovered again.
+*/
+func (a *Aggregate[T]) Release(batch []T) {
+	if cap(batch) == 0 {
+		return
+	}
+
+	if a.wal != nil {
+		a.releaseRecords(&batch[:1][0])
+	}
+
+	// the items are cleared so that they can be garbage collected.
+	var zero T
+	batch = batch[:cap(batch)]
+	for i := range batch {
+		batch[i] = zero
+	}
+
+	a.spare = batch[:0]
+}
+
+// acknowledge removes the records of a payload that was returned by Swap from the write-ahead log, without reusing its buffer.
+func (a *Aggregate[T]) acknowledge(batch []T) {
+	if a.wal != nil && len(batch) > 0 {
+		a.releaseRecords(&batch[0])
+	}
+}
+
+// inflight is a payload that was returned by Swap and has records in the write-ahead log.
+type inflight[T any] struct {
+	// first identifies the payload by its first item and end is the offset in the log where its records end.
+	first    *T
+	end      int64
+	released bool
+}
+
+// holdRecords keeps the records of a payload that is being swapped in the write-ahead log. The records of any pending chunks follow the records of the payload, because they were appended when the item was split.
+func (a *Aggregate[T]) holdRecords(batch []T) {
+	end := a.wal.size
+	for _, chunk := range a.pending {
+		end -= int64(walHeaderSize + len(a.walEncode(chunk)))
+	}
+
+	a.inflight = append(a.inflight, inflight[T]{first: &batch[0], end: end})
+}
+
+// releaseRecords marks the swapped payload that starts with first as released and removes the records of the released payloads that are older than every unreleased payload from the write-ahead log.
+func (a *Aggregate[T]) releaseRecords(first *T) {
+	for i := range a.inflight {
+		if p := &a.inflight[i]; p.first == first && !p.released {
+			p.released = true
+			break
+		}
+	}
+
+	var n int
+	var end int64
+	for n < len(a.inflight) && a.inflight[n].released {
+		end = a.inflight[n].end
+		n++
+	}
+
+	if n == 0 {
+		return
+	}
+
+	a.inflight = append(a.inflight[:0], a.inflight[n:]...)
+	for i := range a.inflight {
+		a.inflight[i].end -= end
+	}
+
+	_ = a.wal.discard(end)
+}
+
+// Swap removes and returns the aggregate payload and resets the aggregate. See Aggregate.Swap.
+func (a *JSON) Swap() []interface{} {
+	batch := a.Aggregate.Swap()
+	a.encoded = a.encoded[:0]
+
+	return batch
+}
@@ -0,0 +1,173 @@
+package aggregate
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStringsSwap(t *testing.T) {
+	agg := Strings{}
+	agg.New(3, 100, time.Minute)
+
+	if batch := agg.Swap(); batch != nil {
+		t.Logf("expected nil, got %v", batch)
+		t.Fail()
+	}
+
+	for _, data := range []string{"foo", "bar", "baz"} {
+		agg.Add(data)
+	}
+
+	batch := agg.Swap()
+	if agg.Count() != 0 {
+		t.Logf("expected %v, got %v", 0, agg.Count())
+		t.Fail()
+	}
+
+	// the swapped payload is not overwritten by new items.
+	for _, data := range []string{"qux", "quux", "corge"} {
+		agg.Add(data)
+	}
+
+	if strings.Join(batch, ",") != "foo,bar,baz" {
+		t.Logf("expected %v, got %v", "foo,bar,baz", batch)
+		t.Fail()
+	}
+
+	// a released payload is used by the next swap.
+	agg.Release(batch)
+	next := agg.Swap()
+	agg.Add("grault")
+
+	if strings.Join(next, ",") != "qux,quux,corge" || &next[:1][0] == &agg.items[:1][0] {
+		t.Logf("expected %v, got %v", "qux,quux,corge", next)
+		t.Fail()
+	}
+
+	if len(agg.items) != 1 || &agg.items[0] != &batch[:1][0] {
+		t.Logf("expected the released payload to be reused")
+		t.Fail()
+	}
+}
+
+func TestBytesSwap(t *testing.T) {
+	var tests = []struct {
+		name string
+		set  func(*Bytes)
+	}{
+		{
+			"copy",
+			func(a *Bytes) { a.SetCopy(true) },
+		},
+		{
+			"contiguous",
+			func(a *Bytes) { a.SetContiguous(true) },
+		},
+	}
+
+	for _, test := range tests {
+		agg := Bytes{}
+		agg.New(3, 100, time.Minute)
+		test.set(&agg)
+
+		buf := make([]byte, 3)
+		add := func(data string) {
+			copy(buf, data)
+			agg.Add(buf)
+		}
+
+		for _, data := range []string{"foo", "bar", "baz"} {
+			add(data)
+		}
+		batch := agg.Swap()
+
+		// the memory that holds the swapped payload is not reused by new items.
+		for _, data := range []string{"qux", "xyz", "abc"} {
+			add(data)
+		}
+		agg.Reset()
+		add("def")
+
+		var items []string
+		for _, p := range batch {
+			items = append(items, string(p))
+		}
+
+		if strings.Join(items, ",") != "foo,bar,baz" {
+			t.Logf("%s: expected %v, got %v", test.name, "foo,bar,baz", items)
+			t.Fail()
+		}
+	}
+}
+
+func TestJSONSwap(t *testing.T) {
+	agg := JSON{}
+	agg.New(3, 100, time.Minute)
+
+	agg.Add(map[string]string{"foo": "bar"})
+	batch := agg.Swap()
+
+	if payload, _ := agg.Encode(); len(batch) != 1 || len(agg.GetEncoded()) != 0 || string(payload) != "" {
+		t.Logf("expected the payload to be swapped, got %v and %q", batch, payload)
+		t.Fail()
+	}
+}
+
+// TestSwapWAL tests that the records of swapped payloads are kept in the write-ahead log until the payloads and every older payload are released.
+func TestSwapWAL(t *testing.T) {
+	w := WAL{}
+	if err := w.Open(t.TempDir()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer w.Close()
+
+	agg := Strings{}
+	agg.New(2, 100, time.Minute)
+	agg.SetWAL(&w)
+
+	records := func() string {
+		r, err := w.Records()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		return fmt.Sprintf("%s", r)
+	}
+
+	agg.Add("foo")
+	agg.Add("bar")
+	first := agg.Swap()
+
+	agg.Add("baz")
+	agg.Add("qux")
+	second := agg.Swap()
+
+	agg.Add("quux")
+	if r := records(); r != "[foo bar baz qux quux]" {
+		t.Logf("expected every record to be kept, got %v", r)
+		t.Fail()
+	}
+
+	// the second payload is released first, so its records are kept until the first payload is released.
+	agg.Release(second)
+	if r := records(); r != "[foo bar baz qux quux]" {
+		t.Logf("expected every record to be kept, got %v", r)
+		t.Fail()
+	}
+
+	agg.Release(first)
+	if r := records(); r != "[quux]" {
+		t.Logf("expected %v, got %v", "[quux]", r)
+		t.Fail()
+	}
+
+	third := agg.Swap()
+	agg.Add("corge")
+	agg.Release(third)
+	if r := records(); r != "[corge]" {
+		t.Logf("expected %v, got %v", "[corge]", r)
+		t.Fail()
+	}
+}
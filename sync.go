@@ -0,0 +1,151 @@
+package aggregate
+
+import (
+	"sync"
+	"time"
+)
+
+// Sync wraps an aggregate so that it is safe for concurrent use by multiple goroutines.
+type Sync[T any] struct {
+	mu  sync.Mutex
+	agg Aggregator[T]
+	// release is true if the records of returned payloads are kept in the write-ahead log until the payloads are released.
+	release bool
+}
+
+// New initializes a new Sync aggregate that wraps agg. The wrapped aggregate should not be used directly while it is wrapped by Sync.
+func (a *Sync[T]) New(agg Aggregator[T]) {
+	a.agg = agg
+}
+
+// SetRelease sets whether the records of payloads that are returned by Flush and AddOrFlush are kept in the write-ahead log of the wrapped aggregate until the payloads are released (see Release). By default, the records are removed from the log when the payload is returned, as they are when the aggregate is reset.
+func (a *Sync[T]) SetRelease(release bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.release = release
+}
+
+// Add adds an item to the aggregate payload. See Aggregate.Add for the errors that are returned.
+func (a *Sync[T]) Add(data T) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.agg.Add(data)
+}
+
+/*
+AddOrFlush adds an item to the aggregate payload. If the aggregate is full or has expired, then the payload is removed from the aggregate and returned, the aggregate is reset, and the item is reattempted. All of this happens atomically, so a payload is only ever returned to one caller.
+
+If the aggregate is still full after the payload is removed (for example, because chunks of a split item are pending), then ErrSizeExceeded is returned along with the payload and the item should be reattempted. If the item can never be added to the aggregate, then the error returned by the aggregate is returned along with any payload that was removed.
+
+If the wrapped aggregate has a write-ahead log, then the records of the payload are removed from the log when it is returned, unless SetRelease is enabled; in that case, the payload must be released once it is delivered (see Release) or the log grows until the aggregate is reset.
+*/
+func (a *Sync[T]) AddOrFlush(data T) ([]T, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	err := a.agg.Add(data)
+	switch err {
+	case ErrCountExceeded, ErrSizeExceeded, ErrExpired, ErrIdle:
+	default:
+		return nil, err
+	}
+
+	batch := a.flushLocked()
+	return batch, a.agg.Add(data)
+}
+
+// Flush removes and returns the aggregate payload and resets the aggregate. If the payload is empty, then nil is returned. See AddOrFlush for how the records of the payload are removed from a write-ahead log.
+func (a *Sync[T]) Flush() []T {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.flushLocked()
+}
+
+// Release returns a payload that was returned by Flush or AddOrFlush to the wrapped aggregate, if it supports Swap, so that its buffer can be reused (see Aggregate.Release). If SetRelease is enabled and the wrapped aggregate has a write-ahead log, then payloads must be released once they are delivered so that their records are removed from the log.
+func (a *Sync[T]) Release(batch []T) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if s, ok := a.agg.(swapper[T]); ok {
+		s.Release(batch)
+	}
+}
+
+// swapper is implemented by aggregates that can hand their payload to the caller (see Aggregate.Swap and Aggregate.Release).
+type swapper[T any] interface {
+	Swap() []T
+	Release([]T)
+	acknowledge([]T)
+}
+
+// flushLocked removes and returns the aggregate payload. If the aggregate implements Swap, then it is used so that memory owned by the aggregate is not reused while the caller holds the payload, and the records of the payload are removed from the write-ahead log unless they are kept until the payload is released. The caller must hold the lock.
+func (a *Sync[T]) flushLocked() []T {
+	if a.agg.Count() == 0 {
+		return nil
+	}
+
+	if s, ok := a.agg.(swapper[T]); ok {
+		batch := s.Swap()
+		if !a.release {
+			s.acknowledge(batch)
+		}
+
+		return batch
+	}
+
+	batch := append([]T(nil), a.agg.Get()...)
+	a.agg.Reset()
+
+	return batch
+}
+
+// Get returns a copy of the aggregate payload.
+func (a *Sync[T]) Get() []T {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return append([]T(nil), a.agg.Get()...)
+}
+
+// Reset resets the aggregate to its initialized settings.
+func (a *Sync[T]) Reset() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.agg.Reset()
+}
+
+// Count returns the number of items in the aggregate payload.
+func (a *Sync[T]) Count() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.agg.Count()
+}
+
+// Size returns the total size of the items in the aggregate payload.
+func (a *Sync[T]) Size() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.agg.Size()
+}
+
+// Expired returns the error that describes whether the aggregate payload has expired. See Aggregate.Expired.
+func (a *Sync[T]) Expired() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.agg.Expired()
+}
+
+// Deadline returns the time when the aggregate payload will expire. See Aggregate.Deadline.
+func (a *Sync[T]) Deadline() time.Time {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.agg.Deadline()
+}
@@ -0,0 +1,180 @@
+package aggregate
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var _ Aggregator[string] = (*Sync[string])(nil)
+
+// TestSyncAddOrFlush tests that every item is returned exactly once when many goroutines add to the same aggregate. Run with -race to check for data races.
+func TestSyncAddOrFlush(t *testing.T) {
+	var tests = []struct {
+		goroutines int
+		items      int
+		maxCount   int
+	}{
+		{8, 1000, 10},
+		{16, 500, 3},
+	}
+
+	for _, test := range tests {
+		agg := Strings{}
+		agg.New(test.maxCount, 1<<20, time.Minute)
+
+		s := Sync[string]{}
+		s.New(&agg)
+
+		var mu sync.Mutex
+		seen := make(map[string]int)
+		collect := func(batch []string) {
+			if len(batch) > test.maxCount {
+				t.Errorf("expected at most %v items, got %v", test.maxCount, len(batch))
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			for _, item := range batch {
+				seen[item]++
+			}
+		}
+
+		var wg sync.WaitGroup
+		for g := 0; g < test.goroutines; g++ {
+			wg.Add(1)
+			go func(g int) {
+				defer wg.Done()
+				for i := 0; i < test.items; i++ {
+					batch, err := s.AddOrFlush(fmt.Sprintf("%d-%d", g, i))
+					if err != nil {
+						t.Errorf("unexpected error: %v", err)
+					}
+					collect(batch)
+
+					_ = s.Count()
+					_ = s.Size()
+					_ = s.Get()
+				}
+			}(g)
+		}
+		wg.Wait()
+
+		collect(s.Flush())
+
+		if len(seen) != test.goroutines*test.items {
+			t.Logf("expected %v items, got %v", test.goroutines*test.items, len(seen))
+			t.Fail()
+		}
+
+		for item, n := range seen {
+			if n != 1 {
+				t.Logf("expected %v to be flushed once, got %v", item, n)
+				t.Fail()
+			}
+		}
+	}
+}
+
+func TestSyncGet(t *testing.T) {
+	agg := Bytes{}
+	agg.New(100, 100, time.Minute)
+
+	s := Sync[[]byte]{}
+	s.New(&agg)
+	s.Add([]byte("foo"))
+
+	payload := s.Get()
+	s.Reset()
+	s.Add([]byte("bar"))
+
+	if string(payload[0]) != "foo" {
+		t.Logf("expected %v, got %v", "foo", string(payload[0]))
+		t.Fail()
+	}
+}
+
+func TestSyncFlushCopy(t *testing.T) {
+	agg := Bytes{}
+	agg.New(2, 100, time.Minute)
+	agg.SetCopy(true)
+
+	s := Sync[[]byte]{}
+	s.New(&agg)
+
+	var batches [][][]byte
+	buf := make([]byte, 3)
+	for _, data := range []string{"foo", "bar", "baz", "qux", "xyz"} {
+		copy(buf, data)
+		if batch, _ := s.AddOrFlush(buf); batch != nil {
+			batches = append(batches, batch)
+		}
+	}
+
+	// payloads are swapped out of the aggregate, so the arena does not overwrite them.
+	var items []string
+	for _, batch := range batches {
+		for _, p := range batch {
+			items = append(items, string(p))
+		}
+	}
+
+	if strings.Join(items, ",") != "foo,bar,baz,qux" {
+		t.Logf("expected %v, got %v", "foo,bar,baz,qux", items)
+		t.Fail()
+	}
+}
+
+// TestSyncWAL tests that the records of flushed payloads are removed from the write-ahead log when they are returned, unless they are kept until the payloads are released.
+func TestSyncWAL(t *testing.T) {
+	for _, release := range []bool{false, true} {
+		w := WAL{}
+		if err := w.Open(t.TempDir()); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		agg := Strings{}
+		agg.New(2, 100, time.Minute)
+		agg.SetWAL(&w)
+
+		s := Sync[string]{}
+		s.New(&agg)
+		s.SetRelease(release)
+
+		records := func() string {
+			r, err := w.Records()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			return fmt.Sprintf("%s", r)
+		}
+
+		var batch []string
+		for _, data := range []string{"foo", "bar", "baz"} {
+			if b, _ := s.AddOrFlush(data); b != nil {
+				batch = b
+			}
+		}
+
+		expected := "[baz]"
+		if release {
+			expected = "[foo bar baz]"
+		}
+
+		if r := records(); r != expected {
+			t.Logf("release %v: expected %v, got %v", release, expected, r)
+			t.Fail()
+		}
+
+		s.Release(batch)
+		if r := records(); r != "[baz]" {
+			t.Logf("release %v: expected %v, got %v", release, "[baz]", r)
+			t.Fail()
+		}
+
+		w.Close()
+	}
+}
@@ -0,0 +1,278 @@
+package aggregate
+
+import (
+	"bufio"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// ErrCorruptRecord is returned when a record read from a file does not match its checksum.
+const ErrCorruptRecord = Error("ErrCorruptRecord")
+
+// walName is the name of the write-ahead log file in the WAL directory.
+const walName = "aggregate.wal"
+
+// walHeaderSize is the size of the header of each record, which contains the length and the CRC-32 checksum of the record.
+const walHeaderSize = 8
+
+/*
+WAL is a write-ahead log that stores the items of an aggregate payload in a local directory so that they survive a crash of the process. Each directory should only be used by one aggregate.
+
+Records are written to the operating system as they are appended. If the WAL is also expected to survive a crash of the operating system, then every append can be synced to disk (see SetSync).
+*/
+type WAL struct {
+	dir  string
+	f    *os.File
+	sync bool
+	buf  []byte
+	// size is the size of the complete records in the log, which is where a failed append is rolled back to.
+	size int64
+	// err is the last error that left the log in an unknown state, such as a failed truncate or sync. Once it is set, no more records can be appended until the log is truncated.
+	err error
+}
+
+// Open opens the write-ahead log in dir, creating the directory and the log if they do not exist. If the log ends with a partially written or corrupted record, such as after a crash, then that record and any following it are removed so that new records are not appended after them.
+func (w *WAL) Open(dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(filepath.Join(dir, walName), os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+
+	size, err := readRecords(f, func([]byte) {})
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Truncate(size); err != nil {
+		f.Close()
+		return err
+	}
+
+	w.dir = dir
+	w.f = f
+	w.size = size
+	w.err = nil
+
+	return nil
+}
+
+// SetSync enables or disables syncing the log to disk after every append.
+func (w *WAL) SetSync(enabled bool) {
+	w.sync = enabled
+}
+
+/*
+Append appends a record to the log. If the record cannot be written, then any part of it that was written is removed from the log and the error is returned, so later records are never appended after an incomplete record.
+
+If the incomplete record cannot be removed or the log cannot be synced (see SetSync), then the state of the log is unknown and every later append returns the error until the log is truncated.
+*/
+func (w *WAL) Append(b []byte) error {
+	if w.err != nil {
+		return w.err
+	}
+
+	w.buf = appendRecord(w.buf[:0], b)
+	if _, err := w.f.Write(w.buf); err != nil {
+		w.rollback()
+		return err
+	}
+
+	if w.sync {
+		if err := w.f.Sync(); err != nil {
+			w.rollback()
+			w.err = err
+			return err
+		}
+	}
+
+	w.size += int64(len(w.buf))
+	return nil
+}
+
+// rollback removes a record that failed to be appended from the log.
+func (w *WAL) rollback() {
+	if err := w.f.Truncate(w.size); err != nil {
+		w.err = err
+	}
+}
+
+// Truncate removes all records from the log.
+func (w *WAL) Truncate() error {
+	if err := w.f.Truncate(0); err != nil {
+		w.err = err
+		return err
+	}
+
+	if w.sync {
+		if err := w.f.Sync(); err != nil {
+			w.err = err
+			return err
+		}
+	}
+
+	w.size = 0
+	w.err = nil
+	return nil
+}
+
+// Rewrite atomically replaces all records in the log with records.
+func (w *WAL) Rewrite(records [][]byte) error {
+	tmp, err := os.CreateTemp(w.dir, walName+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	bw := bufio.NewWriter(tmp)
+	for _, r := range records {
+		if _, err := bw.Write(appendRecord(w.buf[:0], r)); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+
+	if err := bw.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), filepath.Join(w.dir, walName)); err != nil {
+		return err
+	}
+
+	// the rename is only durable once the directory is synced.
+	if err := syncDir(w.dir); err != nil {
+		return err
+	}
+
+	w.f.Close()
+	return w.Open(w.dir)
+}
+
+// discard removes the records before offset n from the log.
+func (w *WAL) discard(n int64) error {
+	if n <= 0 {
+		return nil
+	}
+
+	f, err := os.Open(filepath.Join(w.dir, walName))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := f.Seek(n, io.SeekStart); err != nil {
+		return err
+	}
+
+	var records [][]byte
+	if _, err := readRecords(f, func(b []byte) { records = append(records, b) }); err != nil {
+		return err
+	}
+
+	return w.Rewrite(records)
+}
+
+// Records returns all records in the log. If the log ends with a partially written or corrupted record, then that record and any following it are ignored.
+func (w *WAL) Records() ([][]byte, error) {
+	f, err := os.Open(filepath.Join(w.dir, walName))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var records [][]byte
+	if _, err := readRecords(f, func(b []byte) { records = append(records, b) }); err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+// Close closes the log. The records in the log are kept.
+func (w *WAL) Close() error {
+	return w.f.Close()
+}
+
+// appendRecord appends the header and data of a record to dst.
+func appendRecord(dst, b []byte) []byte {
+	var header [walHeaderSize]byte
+	binary.BigEndian.PutUint32(header[0:4], uint32(len(b)))
+	binary.BigEndian.PutUint32(header[4:8], crc32.ChecksumIEEE(b))
+
+	dst = append(dst, header[:]...)
+	return append(dst, b...)
+}
+
+// readRecords passes each record in r to fn until the end of the log or the first partially written or corrupted record, and returns the size of the records that were read.
+func readRecords(r io.Reader, fn func([]byte)) (int64, error) {
+	var size int64
+	br := bufio.NewReader(r)
+	for {
+		b, err := readRecord(br)
+		switch err {
+		case nil:
+			fn(b)
+			size += int64(walHeaderSize + len(b))
+		case io.EOF, io.ErrUnexpectedEOF, ErrCorruptRecord:
+			return size, nil
+		default:
+			return 0, err
+		}
+	}
+}
+
+// syncDir syncs a directory so that the files that were created, renamed, or removed in it are durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+
+	if err := d.Sync(); err != nil {
+		d.Close()
+		return err
+	}
+
+	return d.Close()
+}
+
+// readRecord reads the next record from r. If there are no more records, then io.EOF is returned; if the last record is incomplete, then io.ErrUnexpectedEOF is returned.
+func readRecord(r *bufio.Reader) ([]byte, error) {
+	var header [walHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, binary.BigEndian.Uint32(header[0:4]))
+	if _, err := io.ReadFull(r, b); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+
+		return nil, err
+	}
+
+	if crc32.ChecksumIEEE(b) != binary.BigEndian.Uint32(header[4:8]) {
+		return nil, ErrCorruptRecord
+	}
+
+	return b, nil
+}
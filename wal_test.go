@@ -0,0 +1,253 @@
+package aggregate
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWALRecords(t *testing.T) {
+	var tests = []struct {
+		data []string
+		torn int
+	}{
+		{
+			[]string{"foo", "bar", "baz"},
+			0,
+		},
+		{
+			[]string{"foo", "bar", "baz"},
+			2,
+		},
+	}
+
+	for _, test := range tests {
+		dir := t.TempDir()
+		w := WAL{}
+		if err := w.Open(dir); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		for _, data := range test.data {
+			w.Append([]byte(data))
+		}
+		w.Close()
+
+		// a torn write leaves a partial record at the end of the log.
+		path := filepath.Join(dir, walName)
+		info, _ := os.Stat(path)
+		os.Truncate(path, info.Size()-int64(test.torn))
+
+		w.Open(dir)
+		records, err := w.Records()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		expected := test.data
+		if test.torn > 0 {
+			expected = expected[:len(expected)-1]
+		}
+
+		if len(records) != len(expected) {
+			t.Fatalf("expected %v, got %v", len(expected), len(records))
+		}
+
+		for i, r := range records {
+			if string(r) != expected[i] {
+				t.Logf("expected %v, got %v", expected[i], string(r))
+				t.Fail()
+			}
+		}
+
+		w.Truncate()
+		if records, _ := w.Records(); len(records) != 0 {
+			t.Logf("expected %v, got %v", 0, len(records))
+			t.Fail()
+		}
+		w.Close()
+	}
+}
+
+// TestWALAppendTorn tests that records appended after a torn write are recovered.
+func TestWALAppendTorn(t *testing.T) {
+	dir := t.TempDir()
+	w := WAL{}
+	if err := w.Open(dir); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	w.Append([]byte("foo"))
+	w.Append([]byte("bar"))
+	w.Close()
+
+	path := filepath.Join(dir, walName)
+	info, _ := os.Stat(path)
+	os.Truncate(path, info.Size()-2)
+
+	if err := w.Open(dir); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer w.Close()
+
+	if err := w.Append([]byte("baz")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	records, err := w.Records()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []string{"foo", "baz"}
+	if len(records) != len(expected) {
+		t.Fatalf("expected %v, got %v", len(expected), len(records))
+	}
+
+	for i, r := range records {
+		if string(r) != expected[i] {
+			t.Logf("expected %v, got %v", expected[i], string(r))
+			t.Fail()
+		}
+	}
+}
+
+// TestWALAppendFailure tests that a failed append that cannot be rolled back prevents later appends.
+func TestWALAppendFailure(t *testing.T) {
+	dir := t.TempDir()
+	w := WAL{}
+	if err := w.Open(dir); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer w.Close()
+
+	w.Append([]byte("foo"))
+
+	// the log is replaced by a read-only file, so writing and truncating it both fail.
+	f := w.f
+	w.f, _ = os.Open(filepath.Join(dir, walName))
+	if err := w.Append([]byte("bar")); err == nil {
+		t.Fatal("expected error")
+	}
+	w.f.Close()
+	w.f = f
+
+	if err := w.Append([]byte("baz")); err == nil {
+		t.Log("expected error")
+		t.Fail()
+	}
+
+	if records, _ := w.Records(); len(records) != 1 || string(records[0]) != "foo" {
+		t.Logf("expected [foo], got %q", records)
+		t.Fail()
+	}
+
+	if err := w.Truncate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := w.Append([]byte("qux")); err != nil {
+		t.Logf("unexpected error: %v", err)
+		t.Fail()
+	}
+}
+
+// TestStringsRecover tests that items added before a crash are recovered by a new aggregate.
+func TestStringsRecover(t *testing.T) {
+	dir := t.TempDir()
+
+	w := WAL{}
+	w.Open(dir)
+	agg := Strings{}
+	agg.New(100, 100, time.Minute)
+	agg.SetWAL(&w)
+
+	agg.Add("foo")
+	agg.Reset()
+	agg.Add("bar")
+	agg.Add("baz")
+	w.Close()
+
+	recovered := WAL{}
+	recovered.Open(dir)
+	defer recovered.Close()
+
+	agg = Strings{}
+	agg.New(100, 100, time.Minute)
+	agg.SetWAL(&recovered)
+	if err := agg.Recover(func([]string) {
+		t.Log("unexpected flush")
+		t.Fail()
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	payload := agg.Get()
+	if len(payload) != 2 || payload[0] != "bar" || payload[1] != "baz" {
+		t.Logf("expected %v, got %v", []string{"bar", "baz"}, payload)
+		t.Fail()
+	}
+}
+
+// TestBytesRecoverFlush tests that recovered items that do not fit in one payload are flushed and removed from the log.
+func TestBytesRecoverFlush(t *testing.T) {
+	dir := t.TempDir()
+
+	w := WAL{}
+	w.Open(dir)
+	defer w.Close()
+	for _, data := range []string{"foo", "bar", "baz", "qux", "quux"} {
+		w.Append([]byte(data))
+	}
+
+	agg := Bytes{}
+	agg.New(2, 100, time.Minute)
+	agg.SetWAL(&w)
+
+	var flushed int
+	agg.Recover(func(batch [][]byte) {
+		flushed += len(batch)
+	})
+
+	if flushed != 4 || agg.Count() != 1 || string(agg.Get()[0]) != "quux" {
+		t.Logf("expected %v flushed and %v remaining, got %v and %v", 4, 1, flushed, agg.Count())
+		t.Fail()
+	}
+
+	records, _ := w.Records()
+	if len(records) != 1 || string(records[0]) != "quux" {
+		t.Logf("expected %v, got %v", 1, len(records))
+		t.Fail()
+	}
+
+	agg.Add([]byte("corge"))
+	if records, _ := w.Records(); len(records) != 2 {
+		t.Logf("expected %v, got %v", 2, len(records))
+		t.Fail()
+	}
+}
+
+func TestJSONRecover(t *testing.T) {
+	dir := t.TempDir()
+
+	w := WAL{}
+	w.Open(dir)
+	agg := JSON{}
+	agg.New(100, 100, time.Minute)
+	agg.SetWAL(&w)
+	agg.Add(map[string]string{"foo": "bar"})
+	w.Close()
+
+	w.Open(dir)
+	defer w.Close()
+	agg = JSON{}
+	agg.New(100, 100, time.Minute)
+	agg.SetWAL(&w)
+	agg.Recover(func([]interface{}) {})
+
+	if string(agg.Array()) != `[{"foo":"bar"}]` {
+		t.Logf("expected %v, got %v", `[{"foo":"bar"}]`, string(agg.Array()))
+		t.Fail()
+	}
+}